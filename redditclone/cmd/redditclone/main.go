@@ -1,37 +1,293 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"redditclone/middleware"
+	"redditclone/pkg/automod"
+	"redditclone/pkg/community"
+	"redditclone/pkg/events"
 	"redditclone/pkg/handlers"
+	"redditclone/pkg/live"
+	"redditclone/pkg/moderation"
+	"redditclone/pkg/notifications"
+	"redditclone/pkg/policy"
 	post "redditclone/pkg/posts"
 	"redditclone/pkg/session"
+	"redditclone/pkg/token"
 	"redditclone/pkg/user"
+	"redditclone/pkg/webhooks"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
-func AddHandleFuncs(r *mux.Router, f handlers.UserHandler, p handlers.PostHandler) {
+var (
+	storage = flag.String("storage", "memory", "posts and users storage backend: memory or sqlite")
+	dbPath  = flag.String("db", "redditclone.db", "path to the sqlite database file")
+	hashAlg = flag.String("password-hash", "argon2id", "password hashing algorithm: argon2id or bcrypt")
+	hashOld = flag.Bool("hash-plaintext-passwords", false, "hash the passwords a sqlite database still keeps in plaintext, once")
+	jwtKeys = flag.String("jwt-keys", "", "path to the JSON file with JWT signing keys")
+	jwtTTL  = flag.Duration("access-ttl", 15*time.Minute, "access token lifetime")
+	admins  = flag.String("admins", "", "comma separated user names that get the admin role")
+
+	sessionTTL     = flag.Duration("session-ttl", session.DefaultConfig.AbsoluteTimeout, "absolute session lifetime")
+	sessionIdle    = flag.Duration("session-idle", session.DefaultConfig.IdleTimeout, "idle session timeout, 0 disables it")
+	sessionSliding = flag.Bool("session-sliding", session.DefaultConfig.Sliding, "renew the session cookie on activity")
+	sessionSweep   = flag.Duration("session-sweep", time.Minute, "interval between expired session sweeps, 0 disables them")
+	sessionStore   = flag.String("session-store", "memory", "session store: memory or redis")
+	redisURL       = flag.String("redis-url", "redis://localhost:6379/0", "redis connection URL for the redis session store")
+
+	webhookAttempts = flag.Int("webhook-attempts", webhooks.DefaultMaxAttempts, "delivery attempts before a webhook delivery is dead")
+	webhookBackoff  = flag.Duration("webhook-backoff", webhooks.DefaultBaseDelay, "delay before the first webhook retry, doubled on each retry")
+	webhookDisable  = flag.Int("webhook-disable-after", webhooks.DefaultDisableAfter, "dead deliveries in a row that disable a webhook, 0 never disables")
+)
+
+func newSessionStore() (session.Store, error) {
+	switch *sessionStore {
+	case "memory":
+		return session.NewMemoryStore(), nil
+	case "redis":
+		opts, err := redis.ParseURL(*redisURL)
+		if err != nil {
+			return nil, err
+		}
+		return session.NewRedisStore(redis.NewClient(opts), "redditclone:"), nil
+	default:
+		return nil, fmt.Errorf("unknown session store %q", *sessionStore)
+	}
+}
+
+func newTokenManager(lg *zap.SugaredLogger) (*token.Manager, error) {
+	ttl := *jwtTTL
+	if *jwtKeys != "" {
+		active, keys, err := token.LoadKeys(*jwtKeys)
+		if err != nil {
+			return nil, err
+		}
+		return token.NewManager(active, keys, ttl)
+	}
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return token.NewManager("default", []*token.Key{token.NewHMACKey("default", []byte(secret))}, ttl)
+	}
+
+	lg.Warn("no JWT keys configured, tokens will not survive a restart")
+	key, err := token.GenerateHMACKey("ephemeral")
+	if err != nil {
+		return nil, err
+	}
+	return token.NewManager(key.ID, []*token.Key{key}, ttl)
+}
+
+func newHasher() (user.Hasher, error) {
+	argon := user.NewArgon2idHasher()
+	bcrypt := user.NewBcryptHasher(0)
+	switch *hashAlg {
+	case "argon2id":
+		return user.NewPasswordHasher(argon, bcrypt), nil
+	case "bcrypt":
+		return user.NewPasswordHasher(bcrypt, argon), nil
+	default:
+		return nil, fmt.Errorf("unknown password hash %q", *hashAlg)
+	}
+}
+
+type repos struct {
+	posts       post.PostRepo
+	users       user.UserRepo
+	communities community.CommunityRepo
+	modLog      moderation.ModLogRepo
+	reports     moderation.ReportRepo
+	bans        moderation.BanRepo
+	autoMod     automod.ConfigRepo
+	webhooks    webhooks.Repo
+	inbox       notifications.Repo
+}
+
+func newRepos() (*repos, error) {
+	hasher, err := newHasher()
+	if err != nil {
+		return nil, err
+	}
+
+	switch *storage {
+	case "memory":
+		return &repos{
+			posts:       post.NewPostMemoryRepository(),
+			users:       user.NewUserMemRep(hasher),
+			communities: community.NewCommunityMemoryRepository(),
+			modLog:      moderation.NewModLogMemoryRepository(),
+			reports:     moderation.NewReportMemoryRepository(),
+			bans:        moderation.NewBanMemoryRepository(),
+			autoMod:     automod.NewConfigMemoryRepository(),
+			webhooks:    webhooks.NewMemoryRepository(),
+			inbox:       notifications.NewMemoryRepository(),
+		}, nil
+	case "sqlite":
+		db, err := sql.Open("sqlite3", "file:"+*dbPath+"?_foreign_keys=on&_busy_timeout=5000")
+		if err != nil {
+			return nil, err
+		}
+		db.SetMaxOpenConns(1)
+
+		postRepo, err := post.NewPostSQLiteRepository(db)
+		if err != nil {
+			return nil, err
+		}
+		userRepo, err := user.NewUserSQLiteRepository(db, hasher)
+		if err != nil {
+			return nil, err
+		}
+		if *hashOld {
+			if err = userRepo.HashPlaintextPasswords(); err != nil {
+				return nil, err
+			}
+		}
+		communityRepo, err := community.NewCommunitySQLiteRepository(db)
+		if err != nil {
+			return nil, err
+		}
+		modLogRepo, err := moderation.NewModLogSQLiteRepository(db)
+		if err != nil {
+			return nil, err
+		}
+		reportRepo, err := moderation.NewReportSQLiteRepository(db)
+		if err != nil {
+			return nil, err
+		}
+		banRepo, err := moderation.NewBanSQLiteRepository(db)
+		if err != nil {
+			return nil, err
+		}
+		autoModRepo, err := automod.NewConfigSQLiteRepository(db)
+		if err != nil {
+			return nil, err
+		}
+		webhookRepo, err := webhooks.NewSQLiteRepository(db)
+		if err != nil {
+			return nil, err
+		}
+		inboxRepo, err := notifications.NewSQLiteRepository(db)
+		if err != nil {
+			return nil, err
+		}
+		return &repos{posts: postRepo, users: userRepo, communities: communityRepo, modLog: modLogRepo,
+			reports: reportRepo, bans: banRepo, autoMod: autoModRepo, webhooks: webhookRepo, inbox: inboxRepo}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", *storage)
+	}
+}
+
+// promoteAdmins gives the admin role to the listed users that already
+// exist; the others become admins when they register.
+func promoteAdmins(users user.UserRepo, names map[string]bool, lg *zap.SugaredLogger) error {
+	for name := range names {
+		u, err := users.GetUser(name)
+		if errors.Is(err, user.ErrUserNotExist) {
+			lg.Infow("admin is not registered yet", "user", name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = users.SetRole(u.ID, user.RoleAdmin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func adminNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(*admins, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func AddHandleFuncs(r *mux.Router, f handlers.UserHandler, p handlers.PostHandler, c handlers.CommunityHandler, k handlers.KeysHandler) {
+	r.HandleFunc("/.well-known/jwks.json", k.JWKS).Methods("GET")
 	r.HandleFunc("/api/register", f.Register).Methods("POST")
 	r.HandleFunc("/api/login", f.Login).Methods("POST")
-	r.HandleFunc("/api/posts", p.AddPost).Methods("POST")
+	r.HandleFunc("/api/logout", f.Logout).Methods("POST")
+	r.HandleFunc("/api/token/refresh", f.RefreshToken).Methods("POST")
+	r.HandleFunc("/api/sessions", f.ListSessions).Methods("GET")
+	r.HandleFunc("/api/sessions", f.RevokeAllSessions).Methods("DELETE")
+	r.HandleFunc("/api/sessions/{ID}", f.RevokeSession).Methods("DELETE")
+	r.HandleFunc("/api/posts", p.Participation(p.AddPost)).Methods("POST")
 	r.HandleFunc("/api/posts/", p.GetAllPosts).Methods("GET")
+	r.HandleFunc("/api/home", p.GetHomePosts).Methods("GET")
+	r.HandleFunc("/api/search", p.Search).Methods("GET")
+	r.HandleFunc("/api/stream", p.Stream).Methods("GET")
 	r.HandleFunc("/api/post/{ID}", p.GetPost).Methods("GET")
 	r.HandleFunc("/api/posts/{ID}", p.GetPostsWithCategory).Methods("GET")
-	r.HandleFunc("/api/post/{ID}", p.AddComment).Methods("POST")
+	r.HandleFunc("/api/post/{ID}", p.Participation(p.AddComment)).Methods("POST")
+	r.HandleFunc("/api/post/{ID}/lock", p.LockPost).Methods("PUT")
+	r.HandleFunc("/api/post/{ID}/lock", p.UnlockPost).Methods("DELETE")
 	r.HandleFunc("/api/post/{ID}/{ID}", p.DeleteComment).Methods("DELETE")
-	r.HandleFunc("/api/post/{ID}/upvote", p.Upvote).Methods("GET")
-	r.HandleFunc("/api/post/{ID}/downvote", p.Downvote).Methods("GET")
-	r.HandleFunc("/api/post/{ID}/unvote", p.Unvote).Methods("GET")
+	r.HandleFunc("/api/post/{ID}/comments", p.GetCommentTree).Methods("GET")
+	r.HandleFunc("/api/post/{ID}/report", p.ReportPost).Methods("POST")
+	r.HandleFunc("/api/post/{ID}/{ID}", p.Participation(p.ReplyComment)).Methods("POST")
+	r.HandleFunc("/api/post/{ID}/{ID}/report", p.ReportComment).Methods("POST")
+	r.HandleFunc("/api/post/{ID}/upvote", p.Participation(p.Upvote)).Methods("GET")
+	r.HandleFunc("/api/post/{ID}/downvote", p.Participation(p.Downvote)).Methods("GET")
+	r.HandleFunc("/api/post/{ID}/unvote", p.Participation(p.Unvote)).Methods("GET")
+	r.HandleFunc("/api/post/{ID}/{ID}/upvote", p.Participation(p.UpvoteComment)).Methods("GET")
+	r.HandleFunc("/api/post/{ID}/{ID}/downvote", p.Participation(p.DownvoteComment)).Methods("GET")
+	r.HandleFunc("/api/post/{ID}/{ID}/unvote", p.Participation(p.UnvoteComment)).Methods("GET")
 	r.HandleFunc("/api/post/{ID}", p.DeletePost).Methods("DELETE")
+	r.HandleFunc("/api/post/{ID}", p.Participation(p.EditPost)).Methods("PUT")
+	r.HandleFunc("/api/post/{ID}/revisions", p.GetRevisions).Methods("GET")
 	r.HandleFunc("/api/user/{ID}", p.GetUserPosts).Methods("GET")
+	r.HandleFunc("/api/user/{ID}/role", f.SetRole).Methods("PUT")
+	r.HandleFunc("/api/user/{ID}/suspension", f.Suspend).Methods("PUT")
+	r.HandleFunc("/api/user/{ID}/suspension", f.Unsuspend).Methods("DELETE")
+	r.HandleFunc("/api/suspensions", f.GetSuspensions).Methods("GET")
+	r.HandleFunc("/api/notifications", f.GetNotifications).Methods("GET")
+	r.HandleFunc("/api/notifications/unread", f.GetUnreadCount).Methods("GET")
+	r.HandleFunc("/api/notifications/read", f.MarkAllNotificationsRead).Methods("POST")
+	r.HandleFunc("/api/notifications/{ID}/read", f.MarkNotificationRead).Methods("POST")
+	r.HandleFunc("/api/communities", c.GetCommunities).Methods("GET")
+	r.HandleFunc("/api/communities", c.AddCommunity).Methods("POST")
+	r.HandleFunc("/api/community/{ID}", c.GetCommunity).Methods("GET")
+	r.HandleFunc("/api/community/{ID}/members", c.AddMember).Methods("POST")
+	r.HandleFunc("/api/community/{ID}/members/{ID}", c.DeleteMember).Methods("DELETE")
+	r.HandleFunc("/api/community/{ID}/moderators", c.GetModerators).Methods("GET")
+	r.HandleFunc("/api/community/{ID}/moderators", c.AddModerator).Methods("POST")
+	r.HandleFunc("/api/community/{ID}/moderators/{ID}", c.DeleteModerator).Methods("DELETE")
+	r.HandleFunc("/api/community/{ID}/modlog", c.GetModLog).Methods("GET")
+	r.HandleFunc("/api/community/{ID}/modqueue", p.GetModQueue).Methods("GET")
+	r.HandleFunc("/api/community/{ID}/modqueue", p.ResolveQueueItem).Methods("POST")
+	r.HandleFunc("/api/community/{ID}/bans", c.GetBans).Methods("GET")
+	r.HandleFunc("/api/community/{ID}/bans", c.AddBan).Methods("POST")
+	r.HandleFunc("/api/community/{ID}/bans/{ID}", c.DeleteBan).Methods("DELETE")
+	r.HandleFunc("/api/community/{ID}/automod", c.GetAutoMod).Methods("GET")
+	r.HandleFunc("/api/community/{ID}/automod", c.SetAutoMod).Methods("PUT")
+	r.HandleFunc("/api/community/{ID}/webhooks", c.GetWebhooks).Methods("GET")
+	r.HandleFunc("/api/community/{ID}/webhooks", c.AddWebhook).Methods("POST")
+	r.HandleFunc("/api/community/{ID}/webhooks/{ID}", c.DeleteWebhook).Methods("DELETE")
+	r.HandleFunc("/api/community/{ID}/webhooks/{ID}/enable", c.EnableWebhook).Methods("POST")
+	r.HandleFunc("/api/community/{ID}/webhooks/{ID}/deliveries", c.GetDeliveries).Methods("GET")
+	r.HandleFunc("/api/community/{ID}/webhooks/{ID}/deliveries/{ID}", c.Redeliver).Methods("POST")
+	r.HandleFunc("/api/community/{ID}/subscribe", c.Subscribe).Methods("POST")
+	r.HandleFunc("/api/community/{ID}/subscribe", c.Unsubscribe).Methods("DELETE")
+	r.HandleFunc("/api/subscriptions", c.GetSubscriptions).Methods("GET")
 }
 
 func main() {
+	flag.Parse()
 	r := mux.NewRouter()
 
 	rootDir, err := os.Getwd()
@@ -55,12 +311,65 @@ func main() {
 	}
 	lg := logger.Sugar()
 
-	sm := session.NewSessionsManager()
-	f := handlers.UserHandler{Repo: user.NewUserMemRep(), Sessions: sm, Logger: lg}
-	p := handlers.PostHandler{Repo: post.NewPostMemoryRepository(), Logger: lg}
-	AddHandleFuncs(r, f, p)
+	rp, err := newRepos()
+	if err != nil {
+		lg.Fatal(err)
+	}
+	if err = community.EnsureDefaults(rp.communities, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		lg.Fatal(err)
+	}
+	adminSet := adminNames()
+	if err = promoteAdmins(rp.users, adminSet, lg); err != nil {
+		lg.Fatal(err)
+	}
+
+	tm, err := newTokenManager(lg)
+	if err != nil {
+		lg.Fatal(err)
+	}
+
+	store, err := newSessionStore()
+	if err != nil {
+		lg.Fatal(err)
+	}
+
+	sm := session.NewSessionsManager(store, session.Config{
+		AbsoluteTimeout: *sessionTTL,
+		IdleTimeout:     *sessionIdle,
+		Sliding:         *sessionSliding,
+	})
+	stopJanitor := sm.StartJanitor(*sessionSweep)
+	defer stopJanitor()
+
+	bus := events.NewBus(lg)
+	defer bus.Close()
+	rp.posts = events.NewPostRepo(rp.posts, bus)
+	rp.users = events.NewUserRepo(rp.users, bus)
+	rp.modLog = events.NewModLogRepo(rp.modLog, bus)
+	hub := live.NewHub()
+	hub.Attach(bus)
+	dispatcher := webhooks.NewDispatcher(rp.webhooks, lg)
+	dispatcher.MaxAttempts, dispatcher.BaseDelay = *webhookAttempts, *webhookBackoff
+	dispatcher.DisableAfter = *webhookDisable
+	if err = dispatcher.Start(bus, webhooks.DefaultWorkers); err != nil {
+		lg.Fatal(err)
+	}
+	defer dispatcher.Stop()
+	notifier := notifications.NewNotifier(rp.inbox, rp.users, rp.communities, lg)
+	notifier.Attach(bus)
+
+	autoMod := automod.NewCachedRepo(rp.autoMod)
+	pol := &policy.Policy{Communities: rp.communities, Bans: rp.bans}
+	f := handlers.UserHandler{Repo: rp.users, Sessions: sm, Tokens: tm, Policy: pol, Bans: rp.bans, Admins: adminSet,
+		Notifications: rp.inbox, Logger: lg}
+	p := handlers.PostHandler{Repo: rp.posts, Communities: rp.communities, Users: rp.users, Policy: pol, ModLog: rp.modLog,
+		Reports: rp.reports, AutoMod: autoMod, Live: hub, Logger: lg}
+	c := handlers.CommunityHandler{Repo: rp.communities, Users: rp.users, Policy: pol, ModLog: rp.modLog, Bans: rp.bans,
+		AutoMod: autoMod, Webhooks: rp.webhooks, Dispatcher: dispatcher, Logger: lg}
+	k := handlers.KeysHandler{Tokens: tm, Logger: lg}
+	AddHandleFuncs(r, f, p, c, k)
 
-	mux := middleware.Auth(sm, r)
+	mux := middleware.Auth(sm, tm, pol, r)
 	err = http.ListenAndServe(":8080", mux)
 	if err != nil {
 		fmt.Println("ListenAndServe error")
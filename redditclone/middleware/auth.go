@@ -1,28 +1,150 @@
 package middleware
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"redditclone/pkg/moderation"
+	"redditclone/pkg/policy"
 	"redditclone/pkg/session"
+	"redditclone/pkg/token"
+	"strings"
 )
 
 var noAuthUrls = map[string]string{
 
-	"/api/login":      "POST",
-	"/api/register":   "POST",
-	"/api/posts/":     "GET",
-	"/api/post/{ID}":  "GET",
-	"/api/user/{ID}":  "GET",
-	"/api/posts/{ID}": "GET",
+	"/api/login":             "POST",
+	"/api/register":          "POST",
+	"/api/posts/":            "GET",
+	"/api/home":              "GET",
+	"/api/search":            "GET",
+	"/api/stream":            "GET",
+	"/api/post/{ID}":         "GET",
+	"/api/user/{ID}":         "GET",
+	"/api/posts/{ID}":        "GET",
+	"/api/communities":       "GET",
+	"/api/community/{ID}":    "GET",
+	"/.well-known/jwks.json": "GET",
 }
 
-func Auth(sm *session.SessionManager, next http.Handler) http.Handler {
+var ErrTokenRevoked = errors.New("token revoked")
+
+func matchPattern(pattern, path string) bool {
+	patternSegments := strings.Split(pattern, "/")
+	pathSegments := strings.Split(path, "/")
+	if len(patternSegments) != len(pathSegments) {
+		return false
+	}
+
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isNoAuthURL(r *http.Request) bool {
+	for pattern, method := range noAuthUrls {
+		if method == r.Method && matchPattern(pattern, r.URL.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	tokenString := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	return tokenString, tokenString != ""
+}
+
+func sendUnauthorized(w http.ResponseWriter, errorMsg string) {
+	sendMessage(w, http.StatusUnauthorized, errorMsg)
+}
+
+func sendMessage(w http.ResponseWriter, status int, errorMsg string) {
+	resp, err := json.Marshal(map[string]string{"message": errorMsg})
+	if err != nil {
+		http.Error(w, errorMsg, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(resp) //nolint:errcheck
+}
+
+func sessionFromToken(sm *session.SessionManager, tm *token.Manager, tokenString string) (*session.Session, error) {
+	claims, err := tm.Parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := sm.GetSessionByHandle(claims.SessionHandle)
+	if err != nil || sess.UserID != claims.UserID {
+		return nil, ErrTokenRevoked
+	}
+	return sess, nil
+}
+
+// Auth puts the session of the request, or nil, into its context. Sessions
+// of suspended users are ended here, so a suspension takes effect on every
+// instance and for every route.
+func Auth(sm *session.SessionManager, tm *token.Manager, pol *policy.Policy, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if val, ok := noAuthUrls[r.URL.Path]; ok && val == r.Method {
-			next.ServeHTTP(w, r)
-			return
+		noAuth := isNoAuthURL(r)
+
+		var sess *session.Session
+		if tokenString, ok := bearerToken(r); ok {
+			var err error
+			sess, err = sessionFromToken(sm, tm, tokenString)
+			// Browsers keep the session cookie past the short access token
+			// lifetime, so an expired token is not fatal when the cookie is valid.
+			if errors.Is(err, token.ErrTokenExpired) {
+				if cookieSess, cookieErr := sm.CheckSession(r); cookieErr == nil {
+					sess, err = cookieSess, nil
+				}
+			}
+			if err != nil && !noAuth {
+				sendUnauthorized(w, err.Error())
+				return
+			}
+		}
+
+		fromCookie := false
+		if sess == nil {
+			sess, _ = sm.CheckSession(r) //nolint:errcheck
+			fromCookie = true
 		}
 
-		sess, _ := sm.CheckSession(r) //nolint:errcheck
+		if sess != nil {
+			err := pol.CheckSuspension(sess.UserID)
+			switch {
+			case errors.Is(err, moderation.ErrSuspended):
+				sm.DestroyAllSessions(sess.UserID) //nolint:errcheck
+				sm.ClearCookie(w)
+				if !noAuth {
+					sendMessage(w, http.StatusForbidden, err.Error())
+					return
+				}
+				sess = nil
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if fromCookie {
+			sm.RenewCookie(w, sess)
+		}
 
 		ctx := session.CreateContextWithSession(r.Context(), sess)
 		next.ServeHTTP(w, r.WithContext(ctx))
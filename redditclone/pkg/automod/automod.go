@@ -0,0 +1,280 @@
+package automod
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of content a rule applies to.
+const (
+	KindPost    = "post"
+	KindComment = "comment"
+	KindAny     = "any"
+)
+
+const (
+	ActionRemove = "remove"
+	ActionFilter = "filter"
+	ActionFlair  = "flair"
+	ActionLock   = "lock"
+	ActionReply  = "reply"
+)
+
+// Name is the author of the replies and the moderator of the actions of the
+// engine.
+const Name = "AutoModerator"
+
+var ErrNoConfig = errors.New("community has no automoderator config")
+var ErrBadConfig = errors.New("bad automoderator config")
+
+var linkPattern = regexp.MustCompile(`https?://[^\s/?#<>"']+`)
+
+// Rule matches when all of its conditions hold. Title only matches posts;
+// Body is the text of a post or the body of a comment. Domains match the
+// link of a post and links in the text, subdomains included. A rule with
+// ReportsAtLeast is checked each time the content is reported instead of on
+// submission.
+type Rule struct {
+	Name            string   `yaml:"name"`
+	Type            string   `yaml:"type"`
+	Title           string   `yaml:"title"`
+	Body            string   `yaml:"body"`
+	Domains         []string `yaml:"domains"`
+	AccountAgeBelow string   `yaml:"account_age_below"`
+	KarmaBelow      *int     `yaml:"karma_below"`
+	ReportsAtLeast  int      `yaml:"reports_at_least"`
+	Actions         []string `yaml:"actions"`
+	Flair           string   `yaml:"flair"`
+	Reply           string   `yaml:"reply"`
+	Reason          string   `yaml:"reason"`
+
+	title      *regexp.Regexp
+	body       *regexp.Regexp
+	accountAge time.Duration
+}
+
+// Config is the rule set of a community, written in YAML or JSON:
+//
+//	rules:
+//	  - name: new accounts posting links
+//	    type: post
+//	    domains: [example.com]
+//	    account_age_below: 72h
+//	    actions: [filter]
+//	    reason: link from a new account
+type Config struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Subject is the content being checked together with what is known about
+// its author. A zero AccountCreated is an account of unknown age, which is
+// treated as old. Reported is set when the check follows a report.
+type Subject struct {
+	Kind           string
+	Title          string
+	Body           string
+	URL            string
+	AccountCreated time.Time
+	Karma          int
+	Reports        int
+	Reported       bool
+}
+
+// Outcome sums up the actions of all the rules that matched. Reason is the
+// reason of the first rule that removed or filtered the content.
+type Outcome struct {
+	Rules   []string
+	Remove  bool
+	Filter  bool
+	Flair   string
+	Lock    bool
+	Replies []string
+	Reason  string
+}
+
+// Parse reads and checks a config; unknown fields are errors so that a
+// misspelled condition does not silently match everything.
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", ErrBadConfig, err)
+	}
+
+	for i, r := range c.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrBadConfig, r.Name, err)
+		}
+	}
+	return c, nil
+}
+
+func (r *Rule) compile() error {
+	var err error
+	switch r.Type {
+	case "":
+		r.Type = KindAny
+	case KindPost, KindComment, KindAny:
+	default:
+		return fmt.Errorf("unknown type %q", r.Type)
+	}
+
+	if r.Title != "" {
+		if r.title, err = regexp.Compile(r.Title); err != nil {
+			return err
+		}
+	}
+	if r.Body != "" {
+		if r.body, err = regexp.Compile(r.Body); err != nil {
+			return err
+		}
+	}
+	if r.AccountAgeBelow != "" {
+		if r.accountAge, err = time.ParseDuration(r.AccountAgeBelow); err != nil || r.accountAge <= 0 {
+			return fmt.Errorf("account_age_below must be a positive duration such as 72h")
+		}
+	}
+	if r.ReportsAtLeast < 0 {
+		return fmt.Errorf("reports_at_least must be positive")
+	}
+	for i, d := range r.Domains {
+		r.Domains[i] = strings.TrimPrefix(strings.ToLower(d), "www.")
+	}
+
+	if r.title == nil && r.body == nil && len(r.Domains) == 0 && r.accountAge == 0 &&
+		r.KarmaBelow == nil && r.ReportsAtLeast == 0 {
+		return fmt.Errorf("no conditions")
+	}
+
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("no actions")
+	}
+	for _, a := range r.Actions {
+		switch a {
+		case ActionRemove, ActionFilter, ActionLock:
+		case ActionFlair:
+			if r.Flair == "" {
+				return fmt.Errorf("flair action without flair")
+			}
+		case ActionReply:
+			if strings.TrimSpace(r.Reply) == "" {
+				return fmt.Errorf("reply action without reply")
+			}
+		default:
+			return fmt.Errorf("unknown action %q", a)
+		}
+	}
+	return nil
+}
+
+// NeedsKarma tells whether a rule looks at the karma of the author, which
+// is costly to work out.
+func (c *Config) NeedsKarma() bool {
+	for _, r := range c.Rules {
+		if r.KarmaBelow != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate runs the rules against the subject. Rules on report counts only
+// run after reports and the others only on submission.
+func (c *Config) Evaluate(s *Subject, now time.Time) *Outcome {
+	o := &Outcome{}
+	for _, r := range c.Rules {
+		if (r.ReportsAtLeast > 0) != s.Reported || !r.matches(s, now) {
+			continue
+		}
+
+		o.Rules = append(o.Rules, r.Name)
+		for _, a := range r.Actions {
+			switch a {
+			case ActionRemove:
+				o.Remove = true
+			case ActionFilter:
+				o.Filter = true
+			case ActionFlair:
+				o.Flair = r.Flair
+			case ActionLock:
+				o.Lock = true
+			case ActionReply:
+				o.Replies = append(o.Replies, r.Reply)
+			}
+			if (a == ActionRemove || a == ActionFilter) && o.Reason == "" {
+				o.Reason = r.Reason
+				if o.Reason == "" {
+					o.Reason = r.Name
+				}
+			}
+		}
+	}
+	return o
+}
+
+func (r *Rule) matches(s *Subject, now time.Time) bool {
+	if r.Type != KindAny && r.Type != s.Kind {
+		return false
+	}
+	if r.title != nil && (s.Kind != KindPost || !r.title.MatchString(s.Title)) {
+		return false
+	}
+	if r.body != nil && !r.body.MatchString(s.Body) {
+		return false
+	}
+	if len(r.Domains) > 0 && !r.matchesDomain(s) {
+		return false
+	}
+	if r.accountAge > 0 && (s.AccountCreated.IsZero() || now.Sub(s.AccountCreated) >= r.accountAge) {
+		return false
+	}
+	if r.KarmaBelow != nil && s.Karma >= *r.KarmaBelow {
+		return false
+	}
+	if r.ReportsAtLeast > 0 && s.Reports < r.ReportsAtLeast {
+		return false
+	}
+	return true
+}
+
+func (r *Rule) matchesDomain(s *Subject) bool {
+	for _, host := range linkHosts(s) {
+		for _, d := range r.Domains {
+			if host == d || strings.HasSuffix(host, "."+d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// linkHosts returns the hosts of the link of the subject and of the links
+// in its text.
+func linkHosts(s *Subject) []string {
+	links := linkPattern.FindAllString(s.Body, -1)
+	if s.URL != "" {
+		links = append(links, s.URL)
+	}
+
+	hosts := make([]string, 0, len(links))
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		hosts = append(hosts, strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."))
+	}
+	return hosts
+}
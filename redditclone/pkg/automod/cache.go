@@ -0,0 +1,63 @@
+package automod
+
+import (
+	"errors"
+	"sync"
+)
+
+// CachedRepo keeps the parsed config of each community in front of a
+// ConfigRepo, so the rules are compiled once per change instead of once per
+// submission. SetConfig drops the cached config of the community.
+type CachedRepo struct {
+	ConfigRepo
+	mu       sync.Mutex
+	compiled map[string]*Config
+	// version counts the changes, so a config read before a change is not
+	// cached after it.
+	version uint64
+}
+
+func NewCachedRepo(repo ConfigRepo) *CachedRepo {
+	return &CachedRepo{ConfigRepo: repo, compiled: make(map[string]*Config)}
+}
+
+func (repo *CachedRepo) SetConfig(community, config string) error {
+	err := repo.ConfigRepo.SetConfig(community, config)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	delete(repo.compiled, community)
+	repo.version++
+	return err
+}
+
+// Rules returns the compiled config of the community; a community without
+// a config gets an empty one.
+func (repo *CachedRepo) Rules(community string) (*Config, error) {
+	repo.mu.Lock()
+	config, ok := repo.compiled[community]
+	version := repo.version
+	repo.mu.Unlock()
+	if ok {
+		return config, nil
+	}
+
+	data, err := repo.GetConfig(community)
+	switch {
+	case errors.Is(err, ErrNoConfig):
+		config = &Config{}
+	case err != nil:
+		return nil, err
+	default:
+		if config, err = Parse([]byte(data)); err != nil {
+			return nil, err
+		}
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.version == version {
+		repo.compiled[community] = config
+	}
+	return config, nil
+}
@@ -0,0 +1,38 @@
+package automod
+
+import "sync"
+
+// ConfigRepo keeps the config of each community as it was written, so that
+// moderators get their comments and layout back.
+type ConfigRepo interface {
+	GetConfig(community string) (string, error)
+	SetConfig(community, config string) error
+}
+
+type ConfigMemoryRepository struct {
+	configs map[string]string
+	mu      sync.RWMutex
+}
+
+func NewConfigMemoryRepository() *ConfigMemoryRepository {
+	return &ConfigMemoryRepository{configs: make(map[string]string)}
+}
+
+func (repo *ConfigMemoryRepository) GetConfig(community string) (string, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	config, ok := repo.configs[community]
+	if !ok {
+		return "", ErrNoConfig
+	}
+	return config, nil
+}
+
+func (repo *ConfigMemoryRepository) SetConfig(community, config string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.configs[community] = config
+	return nil
+}
@@ -0,0 +1,41 @@
+package automod
+
+import (
+	"database/sql"
+	"errors"
+)
+
+type ConfigSQLiteRepository struct {
+	db *sql.DB
+}
+
+var configSchema = []string{
+	`CREATE TABLE IF NOT EXISTS automod_configs (
+		community TEXT PRIMARY KEY,
+		config    TEXT NOT NULL
+	)`,
+}
+
+func NewConfigSQLiteRepository(db *sql.DB) (*ConfigSQLiteRepository, error) {
+	for _, stmt := range configSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &ConfigSQLiteRepository{db: db}, nil
+}
+
+func (repo *ConfigSQLiteRepository) GetConfig(community string) (string, error) {
+	var config string
+	err := repo.db.QueryRow(`SELECT config FROM automod_configs WHERE community = ?`, community).Scan(&config)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNoConfig
+	}
+	return config, err
+}
+
+func (repo *ConfigSQLiteRepository) SetConfig(community, config string) error {
+	_, err := repo.db.Exec(`INSERT INTO automod_configs (community, config) VALUES (?, ?)
+		ON CONFLICT (community) DO UPDATE SET config = excluded.config`, community, config)
+	return err
+}
@@ -0,0 +1,120 @@
+package community
+
+import (
+	"errors"
+	"regexp"
+)
+
+const (
+	VisibilityPublic     = "public"
+	VisibilityRestricted = "restricted"
+	VisibilityPrivate    = "private"
+)
+
+var ErrCommunityNotFound = errors.New("community not found")
+var ErrCommunityExists = errors.New("community already exists")
+var ErrBadName = errors.New("community name must be 3-21 lowercase letters, digits or underscores")
+var ErrBadVisibility = errors.New("visibility must be public, restricted or private")
+var ErrMemberNotFound = errors.New("member not found")
+var ErrNotSubscribed = errors.New("not subscribed")
+
+// DefaultCommunities are the categories the site started with; they are
+// created as public communities without an owner on startup.
+var DefaultCommunities = []string{"music", "funny", "videos", "programming", "news", "fashion"}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9_]{3,21}$`)
+
+type Member struct {
+	Username string `json:"username"`
+	ID       string `json:"id"`
+}
+
+// Community is a place posts are submitted to. Anyone can read and post in a
+// public community; only members can post in a restricted one, and a private
+// community is hidden from everyone but its members. The owner is always a
+// member.
+type Community struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Rules       []string  `json:"rules"`
+	Owner       Member    `json:"owner"`
+	Visibility  string    `json:"visibility"`
+	Created     string    `json:"created"`
+	Members     []*Member `json:"members,omitempty"`
+}
+
+type CommunityRepo interface {
+	AddCommunity(c *Community) error
+	GetCommunity(name string) (*Community, error)
+	GetAllCommunities() ([]*Community, error)
+	AddMember(name string, m *Member) error
+	DeleteMember(name, userID string) error
+	Subscribe(name, userID string) error
+	Unsubscribe(name, userID string) error
+	GetSubscriptions(userID string) ([]string, error)
+}
+
+// Validate checks the name and visibility of a new community, defaulting
+// an empty visibility to public.
+func (c *Community) Validate() error {
+	if !namePattern.MatchString(c.Name) {
+		return ErrBadName
+	}
+	switch c.Visibility {
+	case "":
+		c.Visibility = VisibilityPublic
+	case VisibilityPublic, VisibilityRestricted, VisibilityPrivate:
+	default:
+		return ErrBadVisibility
+	}
+	if c.Rules == nil {
+		c.Rules = make([]string, 0)
+	}
+	return nil
+}
+
+func (c *Community) IsMember(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	if c.Owner.ID == userID {
+		return true
+	}
+	for _, m := range c.Members {
+		if m.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// CanView reports whether the user (empty for anonymous visitors) may see
+// the community and its posts.
+func (c *Community) CanView(userID string) bool {
+	return c.Visibility != VisibilityPrivate || c.IsMember(userID)
+}
+
+func (c *Community) CanPost(userID string) bool {
+	if c.Visibility == VisibilityPublic {
+		return userID != ""
+	}
+	return c.IsMember(userID)
+}
+
+// EnsureDefaults creates the missing default communities.
+func EnsureDefaults(repo CommunityRepo, created string) error {
+	for _, name := range DefaultCommunities {
+		_, err := repo.GetCommunity(name)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrCommunityNotFound) {
+			return err
+		}
+		c := &Community{Name: name, Visibility: VisibilityPublic, Rules: make([]string, 0), Created: created}
+		if err = repo.AddCommunity(c); err != nil && !errors.Is(err, ErrCommunityExists) {
+			return err
+		}
+	}
+	return nil
+}
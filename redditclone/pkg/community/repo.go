@@ -0,0 +1,146 @@
+package community
+
+import (
+	"sort"
+	"sync"
+)
+
+type CommunityMemoryRepository struct {
+	data map[string]*Community
+	// subscriptions maps a user ID to the names of communities they follow.
+	subscriptions map[string]map[string]bool
+	mu            sync.RWMutex
+}
+
+func NewCommunityMemoryRepository() *CommunityMemoryRepository {
+	return &CommunityMemoryRepository{
+		data:          make(map[string]*Community),
+		subscriptions: make(map[string]map[string]bool),
+	}
+}
+
+// clone returns a copy of c that shares nothing mutable with it, so callers
+// can read the members while AddMember and DeleteMember change the stored
+// community.
+func clone(c *Community) *Community {
+	copied := *c
+	if c.Rules != nil {
+		copied.Rules = make([]string, len(c.Rules))
+		copy(copied.Rules, c.Rules)
+	}
+	copied.Members = nil
+	for _, m := range c.Members {
+		member := *m
+		copied.Members = append(copied.Members, &member)
+	}
+	return &copied
+}
+
+func (repo *CommunityMemoryRepository) AddCommunity(c *Community) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.data[c.Name]; ok {
+		return ErrCommunityExists
+	}
+	repo.data[c.Name] = clone(c)
+	return nil
+}
+
+func (repo *CommunityMemoryRepository) GetCommunity(name string) (*Community, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	c, ok := repo.data[name]
+	if !ok {
+		return nil, ErrCommunityNotFound
+	}
+	return clone(c), nil
+}
+
+func (repo *CommunityMemoryRepository) GetAllCommunities() ([]*Community, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	communities := make([]*Community, 0, len(repo.data))
+	for _, c := range repo.data {
+		communities = append(communities, clone(c))
+	}
+	sort.Slice(communities, func(i, j int) bool {
+		return communities[i].Name < communities[j].Name
+	})
+	return communities, nil
+}
+
+func (repo *CommunityMemoryRepository) AddMember(name string, m *Member) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	c, ok := repo.data[name]
+	if !ok {
+		return ErrCommunityNotFound
+	}
+	if c.IsMember(m.ID) {
+		return nil
+	}
+	member := *m
+	c.Members = append(c.Members, &member)
+	return nil
+}
+
+func (repo *CommunityMemoryRepository) DeleteMember(name, userID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	c, ok := repo.data[name]
+	if !ok {
+		return ErrCommunityNotFound
+	}
+	for i, m := range c.Members {
+		if m.ID == userID {
+			c.Members = append(c.Members[:i], c.Members[i+1:]...)
+			return nil
+		}
+	}
+	return ErrMemberNotFound
+}
+
+func (repo *CommunityMemoryRepository) Subscribe(name, userID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.data[name]; !ok {
+		return ErrCommunityNotFound
+	}
+	if _, ok := repo.subscriptions[userID]; !ok {
+		repo.subscriptions[userID] = make(map[string]bool)
+	}
+	repo.subscriptions[userID][name] = true
+	return nil
+}
+
+func (repo *CommunityMemoryRepository) Unsubscribe(name, userID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.data[name]; !ok {
+		return ErrCommunityNotFound
+	}
+	if !repo.subscriptions[userID][name] {
+		return ErrNotSubscribed
+	}
+	delete(repo.subscriptions[userID], name)
+	return nil
+}
+
+func (repo *CommunityMemoryRepository) GetSubscriptions(userID string) ([]string, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	names := make([]string, 0, len(repo.subscriptions[userID]))
+	for name := range repo.subscriptions[userID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
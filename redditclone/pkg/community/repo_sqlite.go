@@ -0,0 +1,222 @@
+package community
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+type CommunitySQLiteRepository struct {
+	db *sql.DB
+}
+
+var communitiesSchema = []string{
+	`CREATE TABLE IF NOT EXISTS communities (
+		name        TEXT PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		rules       TEXT NOT NULL DEFAULT '[]',
+		owner_id    TEXT NOT NULL DEFAULT '',
+		owner_name  TEXT NOT NULL DEFAULT '',
+		visibility  TEXT NOT NULL,
+		created     TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS community_members (
+		community TEXT NOT NULL REFERENCES communities (name) ON DELETE CASCADE,
+		user_id   TEXT NOT NULL,
+		user_name TEXT NOT NULL,
+		PRIMARY KEY (community, user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS community_subscriptions (
+		community TEXT NOT NULL REFERENCES communities (name) ON DELETE CASCADE,
+		user_id   TEXT NOT NULL,
+		PRIMARY KEY (community, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS community_subscriptions_user_id_idx ON community_subscriptions (user_id)`,
+}
+
+const communityColumns = `name, description, rules, owner_id, owner_name, visibility, created`
+
+func NewCommunitySQLiteRepository(db *sql.DB) (*CommunitySQLiteRepository, error) {
+	for _, stmt := range communitiesSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &CommunitySQLiteRepository{db: db}, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCommunity(row rowScanner) (*Community, error) {
+	c := &Community{}
+	var rules string
+	err := row.Scan(&c.Name, &c.Description, &rules, &c.Owner.ID, &c.Owner.Username, &c.Visibility, &c.Created)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(rules), &c.Rules); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (repo *CommunitySQLiteRepository) loadMembers(c *Community) error {
+	rows, err := repo.db.Query(`SELECT user_id, user_name FROM community_members WHERE community = ? ORDER BY rowid`, c.Name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := &Member{}
+		if err = rows.Scan(&m.ID, &m.Username); err != nil {
+			return err
+		}
+		c.Members = append(c.Members, m)
+	}
+	return rows.Err()
+}
+
+func (repo *CommunitySQLiteRepository) AddCommunity(c *Community) error {
+	rules, err := json.Marshal(c.Rules)
+	if err != nil {
+		return err
+	}
+
+	res, err := repo.db.Exec(`INSERT INTO communities (`+communityColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO NOTHING`,
+		c.Name, c.Description, string(rules), c.Owner.ID, c.Owner.Username, c.Visibility, c.Created)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCommunityExists
+	}
+	return nil
+}
+
+func (repo *CommunitySQLiteRepository) GetCommunity(name string) (*Community, error) {
+	row := repo.db.QueryRow(`SELECT `+communityColumns+` FROM communities WHERE name = ?`, name)
+	c, err := scanCommunity(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommunityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = repo.loadMembers(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (repo *CommunitySQLiteRepository) GetAllCommunities() ([]*Community, error) {
+	rows, err := repo.db.Query(`SELECT ` + communityColumns + ` FROM communities ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+
+	communities := make([]*Community, 0)
+	for rows.Next() {
+		c, err := scanCommunity(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		communities = append(communities, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, c := range communities {
+		if err = repo.loadMembers(c); err != nil {
+			return nil, err
+		}
+	}
+	return communities, nil
+}
+
+func (repo *CommunitySQLiteRepository) AddMember(name string, m *Member) error {
+	if _, err := repo.GetCommunity(name); err != nil {
+		return err
+	}
+
+	_, err := repo.db.Exec(`INSERT INTO community_members (community, user_id, user_name) VALUES (?, ?, ?)
+		ON CONFLICT (community, user_id) DO NOTHING`, name, m.ID, m.Username)
+	return err
+}
+
+func (repo *CommunitySQLiteRepository) DeleteMember(name, userID string) error {
+	if _, err := repo.GetCommunity(name); err != nil {
+		return err
+	}
+
+	res, err := repo.db.Exec(`DELETE FROM community_members WHERE community = ? AND user_id = ?`, name, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+func (repo *CommunitySQLiteRepository) Subscribe(name, userID string) error {
+	if _, err := repo.GetCommunity(name); err != nil {
+		return err
+	}
+
+	_, err := repo.db.Exec(`INSERT INTO community_subscriptions (community, user_id) VALUES (?, ?)
+		ON CONFLICT (community, user_id) DO NOTHING`, name, userID)
+	return err
+}
+
+func (repo *CommunitySQLiteRepository) Unsubscribe(name, userID string) error {
+	if _, err := repo.GetCommunity(name); err != nil {
+		return err
+	}
+
+	res, err := repo.db.Exec(`DELETE FROM community_subscriptions WHERE community = ? AND user_id = ?`, name, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotSubscribed
+	}
+	return nil
+}
+
+func (repo *CommunitySQLiteRepository) GetSubscriptions(userID string) ([]string, error) {
+	rows, err := repo.db.Query(`SELECT community FROM community_subscriptions WHERE user_id = ? ORDER BY community`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,216 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Delivery says where the handler of a subscriber runs.
+type Delivery int
+
+const (
+	// Sync handlers run inside Publish, in the goroutine that made the
+	// change, before the mutation returns to its caller.
+	Sync Delivery = iota
+	// Async handlers run in a goroutine of the subscriber, fed through a
+	// buffer of events.
+	Async
+)
+
+// Overflow says what Publish does when the buffer of an async subscriber
+// is full.
+type Overflow int
+
+const (
+	// Block holds the publisher until the subscriber makes room, or until
+	// BlockTimeout passes and the event is dropped.
+	Block Overflow = iota
+	// Drop discards the event for that subscriber right away.
+	Drop
+)
+
+// DefaultBuffer is the buffer of async subscribers that do not set one.
+const DefaultBuffer = 256
+
+// Options of a subscriber. Names limits it to events of these names; it
+// gets all events when Names is empty. Buffer, Overflow and BlockTimeout
+// only apply to Async delivery; a zero BlockTimeout blocks for as long as
+// it takes.
+type Options struct {
+	Names        []string
+	Delivery     Delivery
+	Buffer       int
+	Overflow     Overflow
+	BlockTimeout time.Duration
+}
+
+type Handler func(e Event)
+
+// Bus hands domain events to the subscribers of this process in the order
+// they were published. A handler that panics is logged and does not affect
+// the publisher or the other subscribers.
+type Bus struct {
+	subs   []*Subscription
+	mu     sync.RWMutex
+	wg     sync.WaitGroup
+	Logger *zap.SugaredLogger
+}
+
+type Subscription struct {
+	name    string
+	handler Handler
+	opts    Options
+	names   map[string]bool
+	queue   chan Event
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Uint64
+	bus     *Bus
+}
+
+func NewBus(logger *zap.SugaredLogger) *Bus {
+	return &Bus{Logger: logger}
+}
+
+// Subscribe registers handler under name, which only shows up in logs.
+func (bus *Bus) Subscribe(name string, handler Handler, opts Options) *Subscription {
+	sub := &Subscription{name: name, handler: handler, opts: opts, done: make(chan struct{}), bus: bus}
+	if len(opts.Names) > 0 {
+		sub.names = make(map[string]bool, len(opts.Names))
+		for _, n := range opts.Names {
+			sub.names[n] = true
+		}
+	}
+	if opts.Delivery == Async {
+		if opts.Buffer <= 0 {
+			sub.opts.Buffer = DefaultBuffer
+		}
+		sub.queue = make(chan Event, sub.opts.Buffer)
+		bus.wg.Add(1)
+		go sub.run()
+	}
+
+	bus.mu.Lock()
+	subs := make([]*Subscription, 0, len(bus.subs)+1)
+	bus.subs = append(append(subs, bus.subs...), sub)
+	bus.mu.Unlock()
+	return sub
+}
+
+// Publish delivers e to every subscriber that wants it: sync handlers are
+// called in turn, async ones get it queued under their overflow rule.
+func (bus *Bus) Publish(e Event) {
+	bus.mu.RLock()
+	subs := bus.subs
+	bus.mu.RUnlock()
+
+	for _, sub := range subs {
+		if sub.names != nil && !sub.names[e.EventName()] {
+			continue
+		}
+		if sub.opts.Delivery == Sync {
+			sub.handle(e)
+			continue
+		}
+		sub.enqueue(e)
+	}
+}
+
+// Close unsubscribes everyone and waits for the async subscribers to
+// handle what is already queued.
+func (bus *Bus) Close() {
+	bus.mu.Lock()
+	subs := bus.subs
+	bus.subs = nil
+	bus.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.stop()
+	}
+	bus.wg.Wait()
+}
+
+func (sub *Subscription) enqueue(e Event) {
+	select {
+	case sub.queue <- e:
+		return
+	default:
+	}
+
+	if sub.opts.Overflow == Block {
+		var timeout <-chan time.Time
+		if sub.opts.BlockTimeout > 0 {
+			timer := time.NewTimer(sub.opts.BlockTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case sub.queue <- e:
+			return
+		case <-sub.done:
+			return
+		case <-timeout:
+		}
+	}
+
+	if sub.dropped.Add(1) == 1 && sub.bus.Logger != nil {
+		sub.bus.Logger.Warnw("event subscriber falls behind, dropping events",
+			"subscriber", sub.name, "event", e.EventName())
+	}
+}
+
+func (sub *Subscription) run() {
+	defer sub.bus.wg.Done()
+	for {
+		select {
+		case e := <-sub.queue:
+			sub.handle(e)
+		case <-sub.done:
+			for {
+				select {
+				case e := <-sub.queue:
+					sub.handle(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (sub *Subscription) handle(e Event) {
+	defer func() {
+		if r := recover(); r != nil && sub.bus.Logger != nil {
+			sub.bus.Logger.Errorw("event handler panicked",
+				"subscriber", sub.name, "event", e.EventName(), "panic", r)
+		}
+	}()
+	sub.handler(e)
+}
+
+// Dropped tells how many events the subscriber missed because its buffer
+// was full.
+func (sub *Subscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Close unsubscribes; an async subscriber still handles what it has queued.
+func (sub *Subscription) Close() {
+	sub.bus.mu.Lock()
+	subs := make([]*Subscription, 0, len(sub.bus.subs))
+	for _, s := range sub.bus.subs {
+		if s != sub {
+			subs = append(subs, s)
+		}
+	}
+	sub.bus.subs = subs
+	sub.bus.mu.Unlock()
+	sub.stop()
+}
+
+func (sub *Subscription) stop() {
+	sub.once.Do(func() { close(sub.done) })
+}
@@ -0,0 +1,257 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type testEvent struct {
+	N int
+}
+
+func (testEvent) EventName() string { return "test" }
+
+type otherEvent struct{}
+
+func (otherEvent) EventName() string { return "other" }
+
+// recorder collects the numbers of the test events it handles.
+type recorder struct {
+	mu   sync.Mutex
+	seen []int
+}
+
+func (rec *recorder) handle(e Event) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.seen = append(rec.seen, e.(testEvent).N)
+}
+
+func (rec *recorder) numbers() []int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]int(nil), rec.seen...)
+}
+
+func newTestBus(t *testing.T) *Bus {
+	t.Helper()
+	bus := NewBus(zap.NewNop().Sugar())
+	t.Cleanup(bus.Close)
+	return bus
+}
+
+func checkInOrder(t *testing.T, got []int, n int) {
+	t.Helper()
+	if len(got) != n {
+		t.Fatalf("handled %d events, want %d", len(got), n)
+	}
+	for i, num := range got {
+		if num != i {
+			t.Fatalf("handled %v, want 0 to %d in order", got, n-1)
+		}
+	}
+}
+
+func TestBusSyncDelivery(t *testing.T) {
+	bus := newTestBus(t)
+	rec := &recorder{}
+	bus.Subscribe("sync", rec.handle, Options{Names: []string{"test"}})
+
+	for i := 0; i < 10; i++ {
+		bus.Publish(testEvent{N: i})
+		// sync handlers are done when Publish returns
+		if got := rec.numbers(); len(got) != i+1 {
+			t.Fatalf("after publishing %d events %d were handled", i+1, len(got))
+		}
+	}
+	bus.Publish(otherEvent{})
+	checkInOrder(t, rec.numbers(), 10)
+}
+
+func TestBusAsyncDeliveryInOrder(t *testing.T) {
+	bus := NewBus(zap.NewNop().Sugar())
+	rec := &recorder{}
+	bus.Subscribe("async", rec.handle, Options{Names: []string{"test"}, Delivery: Async, Buffer: 4})
+
+	const n = 100
+	for i := 0; i < n; i++ {
+		bus.Publish(testEvent{N: i})
+	}
+	bus.Close()
+	checkInOrder(t, rec.numbers(), n)
+}
+
+func TestBusDrop(t *testing.T) {
+	bus := newTestBus(t)
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	rec := &recorder{}
+	sub := bus.Subscribe("slow", func(e Event) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		rec.handle(e)
+	}, Options{Delivery: Async, Buffer: 2, Overflow: Drop})
+
+	bus.Publish(testEvent{N: 0})
+	<-started
+	// the handler holds event 0, the buffer takes 1 and 2, the rest is dropped
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		bus.Publish(testEvent{N: i})
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("publishing to a full subscriber took %v", elapsed)
+	}
+	if got := sub.Dropped(); got != 3 {
+		t.Errorf("Dropped = %d, want 3", got)
+	}
+
+	close(release)
+	sub.Close()
+	bus.Close()
+	checkInOrder(t, rec.numbers(), 3)
+}
+
+func TestBusBlock(t *testing.T) {
+	bus := newTestBus(t)
+	release := make(chan struct{})
+	rec := &recorder{}
+	sub := bus.Subscribe("blocking", func(e Event) {
+		<-release
+		rec.handle(e)
+	}, Options{Delivery: Async, Buffer: 1, Overflow: Block})
+
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 4; i++ {
+			bus.Publish(testEvent{N: i})
+		}
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("Publish did not wait for a full subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish still blocked after the subscriber caught up")
+	}
+
+	sub.Close()
+	bus.Close()
+	checkInOrder(t, rec.numbers(), 4)
+	if got := sub.Dropped(); got != 0 {
+		t.Errorf("Dropped = %d, want 0", got)
+	}
+}
+
+func TestBusBlockTimeout(t *testing.T) {
+	bus := newTestBus(t)
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	sub := bus.Subscribe("stuck", func(e Event) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	}, Options{Delivery: Async, Buffer: 1, Overflow: Block, BlockTimeout: 20 * time.Millisecond})
+	defer close(release)
+
+	bus.Publish(testEvent{N: 0})
+	<-started
+	bus.Publish(testEvent{N: 1})
+
+	start := time.Now()
+	bus.Publish(testEvent{N: 2})
+	elapsed := time.Since(start)
+	if elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Publish to a stuck subscriber took %v, want about the block timeout", elapsed)
+	}
+	if got := sub.Dropped(); got != 1 {
+		t.Errorf("Dropped = %d, want 1", got)
+	}
+}
+
+func TestBusRecoversPanics(t *testing.T) {
+	bus := NewBus(zap.NewNop().Sugar())
+	syncRec, asyncRec := &recorder{}, &recorder{}
+	bus.Subscribe("panics", func(e Event) {
+		if e.(testEvent).N%2 == 0 {
+			panic("even")
+		}
+	}, Options{})
+	bus.Subscribe("panics async", func(e Event) {
+		if e.(testEvent).N%2 == 0 {
+			panic("even")
+		}
+		asyncRec.handle(e)
+	}, Options{Delivery: Async})
+	bus.Subscribe("after", syncRec.handle, Options{})
+
+	for i := 0; i < 4; i++ {
+		bus.Publish(testEvent{N: i})
+	}
+	bus.Close()
+
+	checkInOrder(t, syncRec.numbers(), 4)
+	if got := asyncRec.numbers(); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("async subscriber handled %v after its panics, want [1 3]", got)
+	}
+}
+
+func TestBusCloseDrainsQueues(t *testing.T) {
+	bus := NewBus(zap.NewNop().Sugar())
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	rec := &recorder{}
+	bus.Subscribe("draining", func(e Event) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		rec.handle(e)
+	}, Options{Delivery: Async, Buffer: 16})
+
+	const n = 10
+	for i := 0; i < n; i++ {
+		bus.Publish(testEvent{N: i})
+	}
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the queue was handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	checkInOrder(t, rec.numbers(), n)
+
+	// nothing reaches a closed bus
+	bus.Publish(testEvent{N: n})
+	if got := rec.numbers(); len(got) != n {
+		t.Errorf("handled %d events after Close, want %d", len(got), n)
+	}
+}
@@ -0,0 +1,110 @@
+package events
+
+import (
+	"redditclone/pkg/moderation"
+	post "redditclone/pkg/posts"
+)
+
+// Event is a change that already happened to the domain. Events are
+// values: they hold copies of what changed, so subscribers may keep them.
+type Event interface {
+	EventName() string
+}
+
+const (
+	NamePostCreated       = "PostCreated"
+	NamePostEdited        = "PostEdited"
+	NamePostDeleted       = "PostDeleted"
+	NameCommentAdded      = "CommentAdded"
+	NameCommentDeleted    = "CommentDeleted"
+	NameVoteCast          = "VoteCast"
+	NameUserRegistered    = "UserRegistered"
+	NameUserRoleChanged   = "UserRoleChanged"
+	NameModeratorAdded    = "ModeratorAdded"
+	NameModeratorRemoved  = "ModeratorRemoved"
+	NameModActionRecorded = "ModActionRecorded"
+)
+
+type PostCreated struct {
+	Post post.Post
+}
+
+type PostEdited struct {
+	Post post.Post
+}
+
+type PostDeleted struct {
+	PostID   string
+	Category string
+	Author   post.Author
+	Title    string
+}
+
+// CommentAdded carries the authors of the post and, for replies, of the
+// parent comment, the people a new comment concerns.
+type CommentAdded struct {
+	PostID       string
+	Category     string
+	PostTitle    string
+	PostAuthor   post.Author
+	ParentAuthor post.Author
+	Comment      post.Comment
+}
+
+type CommentDeleted struct {
+	PostID    string
+	Category  string
+	CommentID string
+}
+
+// VoteCast is a vote on a post, or on a comment when CommentID is set.
+// Vote is 0 when the user took the vote back; Score is the score after it.
+type VoteCast struct {
+	PostID           string
+	Category         string
+	CommentID        string
+	UserID           string
+	Author           post.Author
+	Vote             int
+	Score            int
+	UpvotePercentage int
+}
+
+type UserRegistered struct {
+	UserID  string
+	Name    string
+	Created string
+}
+
+type UserRoleChanged struct {
+	UserID string
+	Role   string
+}
+
+type ModeratorAdded struct {
+	UserID    string
+	Community string
+}
+
+type ModeratorRemoved struct {
+	UserID    string
+	Community string
+}
+
+// ModActionRecorded is an entry written to the moderation log of a
+// community, by a moderator or the AutoModerator.
+type ModActionRecorded struct {
+	Action moderation.Action
+}
+
+func (PostCreated) EventName() string       { return NamePostCreated }
+func (PostEdited) EventName() string        { return NamePostEdited }
+func (PostDeleted) EventName() string       { return NamePostDeleted }
+func (CommentAdded) EventName() string      { return NameCommentAdded }
+func (CommentDeleted) EventName() string    { return NameCommentDeleted }
+func (VoteCast) EventName() string          { return NameVoteCast }
+func (UserRegistered) EventName() string    { return NameUserRegistered }
+func (UserRoleChanged) EventName() string   { return NameUserRoleChanged }
+func (ModeratorAdded) EventName() string    { return NameModeratorAdded }
+func (ModeratorRemoved) EventName() string  { return NameModeratorRemoved }
+func (ModActionRecorded) EventName() string { return NameModActionRecorded }
@@ -0,0 +1,211 @@
+package events
+
+import (
+	"redditclone/pkg/moderation"
+	post "redditclone/pkg/posts"
+	"redditclone/pkg/user"
+)
+
+// PostRepo publishes the changes made through the wrapped repository once
+// they succeed. Content held for review is announced when it is released.
+// Events are built from a snapshot the wrapped repository takes, since it
+// keeps changing the posts it hands out.
+type PostRepo struct {
+	post.PostRepo
+	Bus *Bus
+}
+
+func NewPostRepo(repo post.PostRepo, bus *Bus) *PostRepo {
+	return &PostRepo{PostRepo: repo, Bus: bus}
+}
+
+func (repo *PostRepo) AddPost(p *post.Post) error {
+	if err := repo.PostRepo.AddPost(p); err != nil {
+		return err
+	}
+	if !p.Filtered {
+		repo.Bus.Publish(PostCreated{Post: repo.PostRepo.Snapshot(p)})
+	}
+	return nil
+}
+
+func (repo *PostRepo) EditPost(p *post.Post, edit *post.PostEdit, userID, editedTime string) error {
+	if err := repo.PostRepo.EditPost(p, edit, userID, editedTime); err != nil {
+		return err
+	}
+	repo.Bus.Publish(PostEdited{Post: repo.PostRepo.Snapshot(p)})
+	return nil
+}
+
+func (repo *PostRepo) DeletePost(p *post.Post) error {
+	if err := repo.PostRepo.DeletePost(p); err != nil {
+		return err
+	}
+	repo.Bus.Publish(PostDeleted{PostID: p.ID, Category: p.Category, Author: p.Author, Title: p.Title})
+	return nil
+}
+
+func (repo *PostRepo) AddCommentToPost(postID string, comment *post.Comment) error {
+	if err := repo.PostRepo.AddCommentToPost(postID, comment); err != nil {
+		return err
+	}
+	if comment.Filtered {
+		return nil
+	}
+	p, err := repo.PostRepo.GetPost(postID)
+	if err != nil {
+		// the comment is stored; only the event is lost
+		return nil
+	}
+	repo.publishCommentAdded(p, comment.ID)
+	return nil
+}
+
+// SetFiltered announces released content as if it was just submitted.
+func (repo *PostRepo) SetFiltered(p *post.Post, commentID string, filtered bool) error {
+	if err := repo.PostRepo.SetFiltered(p, commentID, filtered); err != nil {
+		return err
+	}
+	if filtered {
+		return nil
+	}
+	if commentID == "" {
+		repo.Bus.Publish(PostCreated{Post: repo.PostRepo.Snapshot(p)})
+		return nil
+	}
+	repo.publishCommentAdded(p, commentID)
+	return nil
+}
+
+func (repo *PostRepo) publishCommentAdded(current *post.Post, commentID string) {
+	p := repo.PostRepo.Snapshot(current)
+	comment, err := p.GetComment(commentID)
+	if err != nil {
+		return
+	}
+	e := CommentAdded{PostID: p.ID, Category: p.Category, PostTitle: p.Title, PostAuthor: p.Author,
+		Comment: *comment}
+	if comment.ParentID != "" {
+		if parent, err := p.GetComment(comment.ParentID); err == nil {
+			e.ParentAuthor = parent.UserAuthor
+		}
+	}
+	repo.Bus.Publish(e)
+}
+
+func (repo *PostRepo) DeleteComment(p *post.Post, commentID string) error {
+	if err := repo.PostRepo.DeleteComment(p, commentID); err != nil {
+		return err
+	}
+	repo.Bus.Publish(CommentDeleted{PostID: p.ID, Category: p.Category, CommentID: commentID})
+	return nil
+}
+
+func (repo *PostRepo) AddVote(p *post.Post, v *post.Vote, voteValue int) error {
+	if err := repo.PostRepo.AddVote(p, v, voteValue); err != nil {
+		return err
+	}
+	repo.publishPostVote(p, v.UserID, voteValue)
+	return nil
+}
+
+func (repo *PostRepo) DeleteVote(p *post.Post, userID string) error {
+	if err := repo.PostRepo.DeleteVote(p, userID); err != nil {
+		return err
+	}
+	repo.publishPostVote(p, userID, 0)
+	return nil
+}
+
+func (repo *PostRepo) AddCommentVote(p *post.Post, commentID string, v *post.Vote) error {
+	if err := repo.PostRepo.AddCommentVote(p, commentID, v); err != nil {
+		return err
+	}
+	repo.publishCommentVote(p, commentID, v.UserID, v.Vote)
+	return nil
+}
+
+func (repo *PostRepo) DeleteCommentVote(p *post.Post, commentID, userID string) error {
+	if err := repo.PostRepo.DeleteCommentVote(p, commentID, userID); err != nil {
+		return err
+	}
+	repo.publishCommentVote(p, commentID, userID, 0)
+	return nil
+}
+
+func (repo *PostRepo) publishPostVote(current *post.Post, userID string, vote int) {
+	p := repo.PostRepo.Snapshot(current)
+	repo.Bus.Publish(VoteCast{PostID: p.ID, Category: p.Category, UserID: userID, Author: p.Author,
+		Vote: vote, Score: p.Score, UpvotePercentage: p.UpvotePercentage})
+}
+
+func (repo *PostRepo) publishCommentVote(current *post.Post, commentID, userID string, vote int) {
+	p := repo.PostRepo.Snapshot(current)
+	comm, err := p.GetComment(commentID)
+	if err != nil {
+		return
+	}
+	repo.Bus.Publish(VoteCast{PostID: p.ID, Category: p.Category, CommentID: commentID, UserID: userID,
+		Author: comm.UserAuthor, Vote: vote, Score: comm.Score})
+}
+
+// UserRepo publishes the changes made through the wrapped repository once
+// they succeed.
+type UserRepo struct {
+	user.UserRepo
+	Bus *Bus
+}
+
+func NewUserRepo(repo user.UserRepo, bus *Bus) *UserRepo {
+	return &UserRepo{UserRepo: repo, Bus: bus}
+}
+
+func (repo *UserRepo) AddUser(u *user.User) error {
+	if err := repo.UserRepo.AddUser(u); err != nil {
+		return err
+	}
+	repo.Bus.Publish(UserRegistered{UserID: u.ID, Name: u.Name, Created: u.Created})
+	return nil
+}
+
+func (repo *UserRepo) SetRole(userID, role string) error {
+	if err := repo.UserRepo.SetRole(userID, role); err != nil {
+		return err
+	}
+	repo.Bus.Publish(UserRoleChanged{UserID: userID, Role: role})
+	return nil
+}
+
+func (repo *UserRepo) AddModerator(userID, community string) error {
+	if err := repo.UserRepo.AddModerator(userID, community); err != nil {
+		return err
+	}
+	repo.Bus.Publish(ModeratorAdded{UserID: userID, Community: community})
+	return nil
+}
+
+func (repo *UserRepo) DeleteModerator(userID, community string) error {
+	if err := repo.UserRepo.DeleteModerator(userID, community); err != nil {
+		return err
+	}
+	repo.Bus.Publish(ModeratorRemoved{UserID: userID, Community: community})
+	return nil
+}
+
+// ModLogRepo publishes the actions written to the wrapped log.
+type ModLogRepo struct {
+	moderation.ModLogRepo
+	Bus *Bus
+}
+
+func NewModLogRepo(repo moderation.ModLogRepo, bus *Bus) *ModLogRepo {
+	return &ModLogRepo{ModLogRepo: repo, Bus: bus}
+}
+
+func (repo *ModLogRepo) AddAction(a *moderation.Action) error {
+	if err := repo.ModLogRepo.AddAction(a); err != nil {
+		return err
+	}
+	repo.Bus.Publish(ModActionRecorded{Action: *a})
+	return nil
+}
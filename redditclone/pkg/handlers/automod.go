@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"redditclone/pkg/automod"
+	"redditclone/pkg/community"
+	"redditclone/pkg/moderation"
+	post "redditclone/pkg/posts"
+	"redditclone/pkg/user"
+	"strings"
+	"time"
+)
+
+var ErrPostLocked = errors.New("post is locked")
+
+// autoModerator acts for the rules engine in the modlog, the mod queue and
+// the replies it writes.
+var autoModerator = &user.User{Name: automod.Name, ID: "automoderator"}
+
+type AutoModResponse struct {
+	Rules int `json:"rules"`
+}
+
+// automoderate checks content written by authorID against the rules of the
+// community, filling in what the rules need to know about the author.
+func (handler *PostHandler) automoderate(name, authorID string, s *automod.Subject) (*automod.Outcome, error) {
+	config, err := handler.AutoMod.Rules(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Rules) == 0 {
+		return &automod.Outcome{}, nil
+	}
+
+	u, err := handler.Users.GetUserByID(authorID)
+	switch {
+	case errors.Is(err, user.ErrUserNotExist):
+	case err != nil:
+		return nil, err
+	case u.Created != "":
+		s.AccountCreated, _ = time.Parse(time.RFC3339Nano, u.Created) //nolint:errcheck
+	}
+	if config.NeedsKarma() {
+		if s.Karma, err = handler.Repo.GetKarma(authorID); err != nil {
+			return nil, err
+		}
+	}
+
+	o := config.Evaluate(s, time.Now())
+	if len(o.Rules) > 0 {
+		handler.Logger.Infow("automoderator rules matched",
+			"community", name, "rules", o.Rules)
+	}
+	return o, nil
+}
+
+// sendAutoRemoved answers a submission the rules removed before it was
+// stored.
+func (handler *PostHandler) sendAutoRemoved(w http.ResponseWriter, name string, o *automod.Outcome, a *moderation.Action) {
+	a.Details = o.Reason + ": " + a.Details
+	handler.recordAction(autoModerator, name, a)
+	http.Error(w, "removed by "+automod.Name+": "+o.Reason, http.StatusForbidden)
+	handler.Logger.Infow("submission removed by automoderator",
+		"community", name, "author", a.Author)
+}
+
+// applyOutcome carries out the actions on stored content: the post, and
+// comm when the content is a comment. The content is in place already, so
+// failures are only logged.
+func (handler *PostHandler) applyOutcome(o *automod.Outcome, p *post.Post, comm *post.Comment) {
+	author, details, commentID := p.Author.Username, p.Title, ""
+	if comm != nil {
+		author, details, commentID = comm.UserAuthor.Username, comm.Body, comm.ID
+	}
+
+	if o.Remove {
+		handler.autoRemove(o, p, comm)
+		return
+	}
+	if o.Flair != "" && o.Flair != p.Flair {
+		if err := handler.Repo.SetFlair(p, o.Flair); err != nil {
+			handler.Logger.Error(err)
+		}
+	}
+	if o.Lock && !p.Locked {
+		if err := handler.Repo.SetLocked(p, true); err != nil {
+			handler.Logger.Error(err)
+		} else {
+			handler.recordAutoLock(p)
+		}
+	}
+	if o.Filter {
+		handler.autoFilter(o, p, comm, details)
+	}
+	for _, reply := range o.Replies {
+		id, err := handler.generateHexID()
+		if err != nil {
+			handler.Logger.Error(err)
+			return
+		}
+		err = handler.Repo.AddCommentToPost(p.ID, &post.Comment{
+			Body:        reply,
+			UserAuthor:  post.Author{Username: autoModerator.Name, ID: autoModerator.ID},
+			CreatedTime: handler.makeFormDate(),
+			ID:          id,
+			ParentID:    commentID,
+			Votes:       make([]*post.Vote, 0),
+		})
+		if err != nil {
+			handler.Logger.Error(err)
+		}
+	}
+	handler.Logger.Infow("automoderator actions applied",
+		"postID", p.ID, "commentID", commentID, "author", author)
+}
+
+// recordAutoLock logs a lock by the rules the way a lock by a moderator is
+// logged, so the author is told about it either way.
+func (handler *PostHandler) recordAutoLock(p *post.Post) {
+	handler.recordAction(autoModerator, p.Category, &moderation.Action{
+		Action:  moderation.ActionLockPost,
+		PostID:  p.ID,
+		Author:  p.Author.Username,
+		Details: p.Title,
+	})
+}
+
+// autoFilter holds the content until a moderator approves it and puts it
+// into the mod queue.
+func (handler *PostHandler) autoFilter(o *automod.Outcome, p *post.Post, comm *post.Comment, details string) {
+	commentID, filtered := "", p.Filtered
+	if comm != nil {
+		commentID, filtered = comm.ID, comm.Filtered
+	}
+	if !filtered {
+		if err := handler.Repo.SetFiltered(p, commentID, true); err != nil {
+			handler.Logger.Error(err)
+			return
+		}
+	}
+	handler.autoReport(o, p, commentID, details)
+}
+
+// autoReport puts the content into the mod queue with the reason of the
+// rule as a report of the engine.
+func (handler *PostHandler) autoReport(o *automod.Outcome, p *post.Post, commentID, details string) {
+	id, err := handler.generateHexID()
+	if err != nil {
+		handler.Logger.Error(err)
+		return
+	}
+	err = handler.Reports.AddReport(&moderation.Report{
+		ID:        id,
+		Community: p.Category,
+		PostID:    p.ID,
+		CommentID: commentID,
+		Reporter:  community.Member{Username: autoModerator.Name, ID: autoModerator.ID},
+		Reason:    o.Reason,
+		Details:   details,
+		Created:   handler.makeFormDate(),
+	})
+	if err != nil && !errors.Is(err, moderation.ErrAlreadyReported) {
+		handler.Logger.Error(err)
+	}
+}
+
+// autoRemove removes reported content and closes its reports.
+func (handler *PostHandler) autoRemove(o *automod.Outcome, p *post.Post, comm *post.Comment) {
+	a := &moderation.Action{PostID: p.ID, Details: o.Reason + ": "}
+	var err error
+	if comm != nil {
+		a.Action, a.CommentID, a.Author = moderation.ActionRemoveComment, comm.ID, comm.UserAuthor.Username
+		a.Details += comm.Body
+		err = handler.Repo.DeleteComment(p, comm.ID)
+	} else {
+		a.Action, a.Author = moderation.ActionRemovePost, p.Author.Username
+		a.Details += p.Title
+		err = handler.Repo.DeletePost(p)
+	}
+	if err != nil {
+		handler.Logger.Error(err)
+		return
+	}
+
+	_, err = handler.Reports.ResolveReports(p.Category, p.ID, a.CommentID, moderation.DecisionRemove)
+	if err != nil && !errors.Is(err, moderation.ErrReportNotFound) {
+		handler.Logger.Error(err)
+	}
+	handler.recordAction(autoModerator, p.Category, a)
+}
+
+// automoderateReport runs the rules on report counts after a report of the
+// post, or of the comment when commentID is set.
+func (handler *PostHandler) automoderateReport(p *post.Post, commentID string) {
+	item, err := handler.queuedItem(p.Category, p.ID, commentID)
+	if err != nil || item == nil {
+		if err != nil {
+			handler.Logger.Error(err)
+		}
+		return
+	}
+
+	s := &automod.Subject{Kind: automod.KindPost, Title: p.Title, Body: p.Text, URL: p.URL,
+		Reports: item.Reports, Reported: true}
+	authorID := p.Author.ID
+	var comm *post.Comment
+	if commentID != "" {
+		if comm, err = p.GetComment(commentID); err != nil {
+			handler.Logger.Error(err)
+			return
+		}
+		s = &automod.Subject{Kind: automod.KindComment, Body: comm.Body, Reports: item.Reports, Reported: true}
+		authorID = comm.UserAuthor.ID
+	}
+
+	o, err := handler.automoderate(p.Category, authorID, s)
+	if err != nil {
+		handler.Logger.Error(err)
+		return
+	}
+	if len(o.Rules) > 0 {
+		handler.applyOutcome(o, p, comm)
+	}
+}
+
+func (handler *PostHandler) setLocked(w http.ResponseWriter, r *http.Request, locked bool) {
+	u, err := actor(r, handler.Users)
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	currentPost, err := handler.getPost(r, strings.Split(r.URL.Path, "/")[3])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	if err = handler.Policy.CanModerate(u, currentPost.Category); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	if err = handler.Repo.SetLocked(currentPost, locked); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	action := moderation.ActionLockPost
+	if !locked {
+		action = moderation.ActionUnlockPost
+	}
+	handler.recordAction(u, currentPost.Category, &moderation.Action{
+		Action:  action,
+		PostID:  currentPost.ID,
+		Author:  currentPost.Author.Username,
+		Details: currentPost.Title,
+	})
+
+	err = handler.SendPost(w, *currentPost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+}
+
+// LockPost stops new comments on a post; moderators may still comment.
+func (handler *PostHandler) LockPost(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("lock post")
+	handler.setLocked(w, r, true)
+}
+
+func (handler *PostHandler) UnlockPost(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("unlock post")
+	handler.setLocked(w, r, false)
+}
+
+// GetAutoMod shows the rules of the community as they were written.
+func (handler *CommunityHandler) GetAutoMod(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get automod")
+	u, c, ok := handler.actorAndCommunity(w, r)
+	if !ok {
+		return
+	}
+	if err := handler.Policy.CanModerate(u, c.Name); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	config, err := handler.AutoMod.GetConfig(c.Name)
+	if errors.Is(err, automod.ErrNoConfig) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	_, errWrite := w.Write([]byte(config))
+	if errWrite != nil {
+		http.Error(w, errWrite.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(errWrite)
+		return
+	}
+}
+
+// SetAutoMod replaces the rules of the community with the YAML or JSON in
+// the body; a config that does not parse is rejected as a whole.
+func (handler *CommunityHandler) SetAutoMod(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("set automod")
+	u, c, ok := handler.actorAndCommunity(w, r)
+	if !ok {
+		return
+	}
+	if err := handler.Policy.CanModerate(u, c.Name); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, ErrReadReqBody.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	config, err := automod.Parse(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	if err = handler.AutoMod.SetConfig(c.Name, string(data)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	recordAction(handler.ModLog, handler.Logger, u, c.Name, &moderation.Action{
+		Action: moderation.ActionEditAutoMod,
+	})
+
+	handler.sendJSON(w, http.StatusOK, AutoModResponse{Rules: len(config.Rules)})
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"redditclone/pkg/community"
+	"redditclone/pkg/moderation"
+	"redditclone/pkg/user"
+	"strings"
+	"time"
+)
+
+type BanForm struct {
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"`
+}
+
+type SuspensionResponse struct {
+	Suspension *moderation.Ban `json:"suspension"`
+	Revoked    int             `json:"revoked"`
+}
+
+func readBanForm(r *http.Request) (*BanForm, error) {
+	js, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		return nil, ErrReadReqBody
+	}
+	bf := &BanForm{}
+	if err = json.Unmarshal(js, bf); err != nil {
+		return nil, ErrJSONUnmarshal
+	}
+	bf.Reason = strings.TrimSpace(bf.Reason)
+	if bf.Reason == "" {
+		return nil, moderation.ErrBadReason
+	}
+	return bf, nil
+}
+
+// newBan fills in a ban of target by u from the form; the empty community
+// makes it a suspension.
+func newBan(u, target *user.User, name string, bf *BanForm) (*moderation.Ban, error) {
+	d, err := moderation.ParseDuration(bf.Duration)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	b := &moderation.Ban{
+		Community: name,
+		User:      community.Member{Username: target.Name, ID: target.ID},
+		Moderator: community.Member{Username: u.Name, ID: u.ID},
+		Reason:    bf.Reason,
+		Created:   now.Format(time.RFC3339Nano),
+	}
+	if d > 0 {
+		b.Expires = now.Add(d).Format(time.RFC3339Nano)
+	}
+	return b, nil
+}
+
+// Participation guards the routes that post, comment or vote: it finds the
+// community the request writes to and rejects suspended users and users
+// banned from it before the handler runs.
+func (handler *PostHandler) Participation(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := viewerID(r)
+		if userID == "" {
+			next(w, r)
+			return
+		}
+
+		names, err := handler.targetCommunities(r)
+		if err != nil {
+			// the handler reports unknown posts and bad bodies itself
+			next(w, r)
+			return
+		}
+		for _, name := range names {
+			if err = handler.Policy.CanParticipate(userID, name); err != nil {
+				sendPolicyError(w, handler.Logger, err)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// targetCommunities returns the community of the post in the path and the
+// category named in the body, if any. The body is put back for the handler.
+func (handler *PostHandler) targetCommunities(r *http.Request) ([]string, error) {
+	names := make([]string, 0, 2)
+
+	pathSegments := strings.Split(r.URL.Path, "/")[1:]
+	if len(pathSegments) > 2 && pathSegments[1] == "post" {
+		currentPost, err := handler.Repo.GetPost(pathSegments[2])
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, currentPost.Category)
+	}
+
+	if r.Body != nil && (r.Method == http.MethodPost || r.Method == http.MethodPut) {
+		js, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(js))
+
+		form := &RequestForm{}
+		if json.Unmarshal(js, form) == nil && form.Category != "" {
+			names = append(names, form.Category)
+		}
+	}
+	return names, nil
+}
+
+// GetBans lists the users banned from the community.
+func (handler *CommunityHandler) GetBans(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get bans")
+	u, c, ok := handler.actorAndCommunity(w, r)
+	if !ok {
+		return
+	}
+	if err := handler.Policy.CanModerate(u, c.Name); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	bans, err := handler.Bans.GetBans(c.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendJSON(w, http.StatusOK, bans)
+}
+
+// AddBan bans a user from posting, commenting and voting in the community.
+func (handler *CommunityHandler) AddBan(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("add ban")
+	u, c, ok := handler.actorAndCommunity(w, r)
+	if !ok {
+		return
+	}
+
+	bf, err := readBanForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	target, err := handler.Users.GetUser(bf.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	if err = handler.Policy.CanBan(u, target, c.Name); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	b, err := newBan(u, target, c.Name, bf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	if err = handler.Bans.AddBan(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	details := b.Reason
+	if b.Expires != "" {
+		details += " (until " + b.Expires + ")"
+	}
+	recordAction(handler.ModLog, handler.Logger, u, c.Name, &moderation.Action{
+		Action:  moderation.ActionBanUser,
+		Author:  target.Name,
+		Details: details,
+	})
+
+	handler.sendJSON(w, http.StatusCreated, b)
+}
+
+// DeleteBan lifts the ban of a user from the community.
+func (handler *CommunityHandler) DeleteBan(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("delete ban")
+	u, c, ok := handler.actorAndCommunity(w, r)
+	if !ok {
+		return
+	}
+	if err := handler.Policy.CanModerate(u, c.Name); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	target, err := handler.Users.GetUser(strings.Split(r.URL.Path, "/")[5])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	err = handler.Bans.DeleteBan(c.Name, target.ID)
+	if errors.Is(err, moderation.ErrNotBanned) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	recordAction(handler.ModLog, handler.Logger, u, c.Name, &moderation.Action{
+		Action: moderation.ActionUnbanUser,
+		Author: target.Name,
+	})
+
+	handler.sendJSON(w, http.StatusOK, DeletePostResponse{Message: "success"})
+}
+
+// adminAndTarget loads the acting admin and the user named in the path; the
+// error response is already sent when ok is false.
+func (handler *UserHandler) adminAndTarget(w http.ResponseWriter, r *http.Request) (*user.User, *user.User, bool) {
+	u, err := actor(r, handler.Repo)
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return nil, nil, false
+	}
+
+	target, err := handler.Repo.GetUser(strings.Split(r.URL.Path, "/")[3])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return nil, nil, false
+	}
+	if err = handler.Policy.CanSuspend(u, target); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return nil, nil, false
+	}
+	return u, target, true
+}
+
+// Suspend bans a user from the whole site and ends all their sessions.
+func (handler *UserHandler) Suspend(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("suspend user")
+	u, target, ok := handler.adminAndTarget(w, r)
+	if !ok {
+		return
+	}
+
+	bf, err := readBanForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	b, err := newBan(u, target, "", bf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	if err = handler.Bans.AddBan(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	revoked, err := handler.Sessions.DestroyAllSessions(target.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	handler.sendJSON(w, http.StatusOK, SuspensionResponse{Suspension: b, Revoked: revoked})
+	handler.Logger.Infow("user suspended",
+		"user", target.Name, "by", u.Name, "expires", b.Expires)
+}
+
+// Unsuspend lifts the suspension of a user.
+func (handler *UserHandler) Unsuspend(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("unsuspend user")
+	u, target, ok := handler.adminAndTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := handler.Bans.DeleteBan("", target.ID)
+	if errors.Is(err, moderation.ErrNotBanned) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	handler.sendJSON(w, http.StatusOK, DeletePostResponse{Message: "success"})
+	handler.Logger.Infow("user unsuspended",
+		"user", target.Name, "by", u.Name)
+}
+
+// GetSuspensions lists the suspended users to admins.
+func (handler *UserHandler) GetSuspensions(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get suspensions")
+	u, err := actor(r, handler.Repo)
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+	if err = handler.Policy.CanManageUsers(u); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	bans, err := handler.Bans.GetBans("")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendJSON(w, http.StatusOK, bans)
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"redditclone/pkg/automod"
+	"redditclone/pkg/community"
+	"redditclone/pkg/moderation"
+	"redditclone/pkg/policy"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"redditclone/pkg/webhooks"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type CommunityHandler struct {
+	Repo       community.CommunityRepo
+	Users      user.UserRepo
+	Policy     *policy.Policy
+	ModLog     moderation.ModLogRepo
+	Bans       moderation.BanRepo
+	AutoMod    *automod.CachedRepo
+	Webhooks   webhooks.Repo
+	Dispatcher *webhooks.Dispatcher
+	Logger     *zap.SugaredLogger
+}
+
+type CommunityForm struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Rules       []string `json:"rules"`
+	Visibility  string   `json:"visibility"`
+}
+
+type MemberForm struct {
+	Username string `json:"username"`
+}
+
+func (handler *CommunityHandler) sendJSON(w http.ResponseWriter, status int, data interface{}) {
+	writeJSON(w, handler.Logger, status, data)
+}
+
+func writeJSON(w http.ResponseWriter, logger *zap.SugaredLogger, status int, data interface{}) {
+	resp, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, ErrJSONMarshal.Error(), http.StatusInternalServerError)
+		logger.Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	_, errWrite := w.Write(resp)
+	if errWrite != nil {
+		http.Error(w, errWrite.Error(), http.StatusInternalServerError)
+		logger.Error(errWrite)
+		return
+	}
+}
+
+// publicView hides the member list from users outside the community.
+func publicView(c *community.Community, userID string) community.Community {
+	view := *c
+	if !c.IsMember(userID) {
+		view.Members = nil
+	}
+	return view
+}
+
+// getVisible looks up a community the user may see; private communities
+// are not found for outsiders.
+func (handler *CommunityHandler) getVisible(name, userID string) (*community.Community, error) {
+	c, err := handler.Repo.GetCommunity(name)
+	if err != nil {
+		return nil, err
+	}
+	if !c.CanView(userID) {
+		return nil, community.ErrCommunityNotFound
+	}
+	return c, nil
+}
+
+func (handler *CommunityHandler) sendLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, community.ErrCommunityNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	handler.Logger.Error(err)
+}
+
+func (handler *CommunityHandler) GetCommunities(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get communities")
+	userID := viewerID(r)
+
+	communities, err := handler.Repo.GetAllCommunities()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	views := make([]community.Community, 0, len(communities))
+	for _, c := range communities {
+		if c.CanView(userID) {
+			views = append(views, publicView(c, userID))
+		}
+	}
+	handler.sendJSON(w, http.StatusOK, views)
+}
+
+func (handler *CommunityHandler) GetCommunity(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get community")
+	name := strings.Split(r.URL.Path, "/")[3]
+	userID := viewerID(r)
+
+	c, err := handler.getVisible(name, userID)
+	if err != nil {
+		handler.sendLookupError(w, err)
+		return
+	}
+	handler.sendJSON(w, http.StatusOK, publicView(c, userID))
+}
+
+func (handler *CommunityHandler) AddCommunity(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("add community")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	js, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, ErrReadReqBody.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	cf := &CommunityForm{}
+	err = json.Unmarshal(js, cf)
+	if err != nil {
+		http.Error(w, ErrJSONUnmarshal.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	c := &community.Community{
+		Name:        cf.Name,
+		Description: cf.Description,
+		Rules:       cf.Rules,
+		Owner:       community.Member{Username: sess.UserName, ID: sess.UserID},
+		Visibility:  cf.Visibility,
+		Created:     time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if err = c.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	err = handler.Repo.AddCommunity(c)
+	if errors.Is(err, community.ErrCommunityExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	handler.sendJSON(w, http.StatusCreated, c)
+	handler.Logger.Infow("community added",
+		"name", c.Name)
+}
+
+// managedCommunity resolves the community in the path and checks that the
+// requesting user may manage it.
+func (handler *CommunityHandler) managedCommunity(w http.ResponseWriter, r *http.Request) (*community.Community, bool) {
+	u, c, ok := handler.actorAndCommunity(w, r)
+	if !ok {
+		return nil, false
+	}
+	if err := handler.Policy.CanManageCommunity(u, c); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return nil, false
+	}
+	return c, true
+}
+
+func (handler *CommunityHandler) actorAndCommunity(w http.ResponseWriter, r *http.Request) (*user.User, *community.Community, bool) {
+	u, err := actor(r, handler.Users)
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return nil, nil, false
+	}
+
+	c, err := handler.getVisible(strings.Split(r.URL.Path, "/")[3], u.ID)
+	if err != nil {
+		handler.sendLookupError(w, err)
+		return nil, nil, false
+	}
+	return u, c, true
+}
+
+func (handler *CommunityHandler) sendMembers(w http.ResponseWriter, name string) {
+	c, err := handler.Repo.GetCommunity(name)
+	if err != nil {
+		handler.sendLookupError(w, err)
+		return
+	}
+	members := c.Members
+	if members == nil {
+		members = make([]*community.Member, 0)
+	}
+	handler.sendJSON(w, http.StatusOK, members)
+}
+
+func (handler *CommunityHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("add community member")
+	c, ok := handler.managedCommunity(w, r)
+	if !ok {
+		return
+	}
+
+	js, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, ErrReadReqBody.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	mf := &MemberForm{}
+	err = json.Unmarshal(js, mf)
+	if err != nil {
+		http.Error(w, ErrJSONUnmarshal.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	u, err := handler.Users.GetUser(mf.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	err = handler.Repo.AddMember(c.Name, &community.Member{Username: u.Name, ID: u.ID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendMembers(w, c.Name)
+}
+
+func (handler *CommunityHandler) DeleteMember(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("delete community member")
+	c, ok := handler.managedCommunity(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := handler.Users.GetUser(strings.Split(r.URL.Path, "/")[5])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	err = handler.Repo.DeleteMember(c.Name, u.ID)
+	if errors.Is(err, community.ErrMemberNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendMembers(w, c.Name)
+}
+
+func (handler *CommunityHandler) subscription(w http.ResponseWriter, r *http.Request, subscribe bool) {
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	c, err := handler.getVisible(strings.Split(r.URL.Path, "/")[3], sess.UserID)
+	if err != nil {
+		handler.sendLookupError(w, err)
+		return
+	}
+
+	if subscribe {
+		err = handler.Repo.Subscribe(c.Name, sess.UserID)
+	} else {
+		err = handler.Repo.Unsubscribe(c.Name, sess.UserID)
+	}
+	if errors.Is(err, community.ErrNotSubscribed) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendSubscriptions(w, sess.UserID)
+}
+
+func (handler *CommunityHandler) sendSubscriptions(w http.ResponseWriter, userID string) {
+	subscriptions, err := handler.Repo.GetSubscriptions(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendJSON(w, http.StatusOK, subscriptions)
+}
+
+func (handler *CommunityHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("subscribe")
+	handler.subscription(w, r, true)
+}
+
+func (handler *CommunityHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("unsubscribe")
+	handler.subscription(w, r, false)
+}
+
+func (handler *CommunityHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get subscriptions")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendSubscriptions(w, sess.UserID)
+}
+
+func (handler *CommunityHandler) sendModerators(w http.ResponseWriter, name string) {
+	moderators, err := handler.Users.GetModerators(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	members := make([]*community.Member, 0, len(moderators))
+	for _, u := range moderators {
+		members = append(members, &community.Member{Username: u.Name, ID: u.ID})
+	}
+	handler.sendJSON(w, http.StatusOK, members)
+}
+
+func (handler *CommunityHandler) GetModerators(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get moderators")
+	c, err := handler.getVisible(strings.Split(r.URL.Path, "/")[3], viewerID(r))
+	if err != nil {
+		handler.sendLookupError(w, err)
+		return
+	}
+	handler.sendModerators(w, c.Name)
+}
+
+func (handler *CommunityHandler) AddModerator(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("add moderator")
+	c, ok := handler.managedCommunity(w, r)
+	if !ok {
+		return
+	}
+
+	js, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, ErrReadReqBody.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	mf := &MemberForm{}
+	err = json.Unmarshal(js, mf)
+	if err != nil {
+		http.Error(w, ErrJSONUnmarshal.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	u, err := handler.Users.GetUser(mf.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	if err = handler.Users.AddModerator(u.ID, c.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendModerators(w, c.Name)
+}
+
+func (handler *CommunityHandler) DeleteModerator(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("delete moderator")
+	c, ok := handler.managedCommunity(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := handler.Users.GetUser(strings.Split(r.URL.Path, "/")[5])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	err = handler.Users.DeleteModerator(u.ID, c.Name)
+	if errors.Is(err, user.ErrNotModerator) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendModerators(w, c.Name)
+}
+
+// GetModLog shows the moderator actions of the community to its moderators.
+func (handler *CommunityHandler) GetModLog(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get modlog")
+	u, c, ok := handler.actorAndCommunity(w, r)
+	if !ok {
+		return
+	}
+	if err := handler.Policy.CanModerate(u, c.Name); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	actions, err := handler.ModLog.GetActions(c.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendJSON(w, http.StatusOK, actions)
+}
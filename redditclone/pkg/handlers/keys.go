@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"redditclone/pkg/token"
+
+	"go.uber.org/zap"
+)
+
+type KeysHandler struct {
+	Tokens *token.Manager
+	Logger *zap.SugaredLogger
+}
+
+func (handler *KeysHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	resp, err := json.Marshal(handler.Tokens.JWKS())
+	if err != nil {
+		http.Error(w, ErrJSONMarshal.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+
+	_, errWrite := w.Write(resp)
+	if errWrite != nil {
+		http.Error(w, errWrite.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(errWrite)
+		return
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"redditclone/pkg/community"
+	"redditclone/pkg/moderation"
+	"redditclone/pkg/policy"
+	post "redditclone/pkg/posts"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// actor loads the account of the logged in user, with its roles.
+func actor(r *http.Request, users user.UserRepo) (*user.User, error) {
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	return users.GetUserByID(sess.UserID)
+}
+
+func sendPolicyError(w http.ResponseWriter, logger *zap.SugaredLogger, err error) {
+	switch {
+	case errors.Is(err, policy.ErrForbidden), errors.Is(err, moderation.ErrSuspended),
+		errors.Is(err, moderation.ErrBanned), errors.Is(err, post.ErrAccessDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	logger.Error(err)
+}
+
+// recordAction writes a moderator action to the log of the community. The
+// action has already been taken, so a failure is only logged.
+func (handler *PostHandler) recordAction(u *user.User, name string, a *moderation.Action) {
+	recordAction(handler.ModLog, handler.Logger, u, name, a)
+}
+
+func recordAction(modLog moderation.ModLogRepo, logger *zap.SugaredLogger, u *user.User, name string, a *moderation.Action) {
+	id, err := GenerateHexID()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	a.ID = id
+	a.Community = name
+	a.Moderator = community.Member{Username: u.Name, ID: u.ID}
+	a.Created = time.Now().UTC().Format(time.RFC3339Nano)
+
+	if err = modLog.AddAction(a); err != nil {
+		logger.Error(err)
+		return
+	}
+	logger.Infow("moderator action",
+		"community", name, "action", a.Action, "moderator", u.Name)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"redditclone/pkg/notifications"
+	"redditclone/pkg/session"
+	"strings"
+)
+
+type NotificationsResponse struct {
+	Notifications []*notifications.Notification `json:"notifications"`
+	Unread        int                           `json:"unread"`
+}
+
+type UnreadResponse struct {
+	Unread int `json:"unread"`
+	Marked int `json:"marked,omitempty"`
+}
+
+// GetNotifications lists the inbox of the user, newest first;
+// ?unread=true leaves out what was read.
+func (handler *UserHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get notifications")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	list, err := handler.Notifications.GetNotifications(sess.UserID, r.URL.Query().Get("unread") == "true")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	unread, err := handler.Notifications.UnreadCount(sess.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	writeJSON(w, handler.Logger, http.StatusOK, NotificationsResponse{Notifications: list, Unread: unread})
+}
+
+// GetUnreadCount is the badge of the inbox.
+func (handler *UserHandler) GetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get unread notifications count")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	unread, err := handler.Notifications.UnreadCount(sess.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	writeJSON(w, handler.Logger, http.StatusOK, UnreadResponse{Unread: unread})
+}
+
+// MarkNotificationRead marks one notification of the user as read.
+func (handler *UserHandler) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("mark notification read")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	err = handler.Notifications.MarkRead(sess.UserID, strings.Split(r.URL.Path, "/")[3])
+	if errors.Is(err, notifications.ErrNotificationNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendUnread(w, sess.UserID, 0)
+}
+
+// MarkAllNotificationsRead empties the unread part of the inbox.
+func (handler *UserHandler) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("mark all notifications read")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	marked, err := handler.Notifications.MarkAllRead(sess.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendUnread(w, sess.UserID, marked)
+}
+
+// sendUnread answers with the unread count left, which may already include
+// notifications that came in meanwhile.
+func (handler *UserHandler) sendUnread(w http.ResponseWriter, userID string, marked int) {
+	unread, err := handler.Notifications.UnreadCount(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	writeJSON(w, handler.Logger, http.StatusOK, UnreadResponse{Unread: unread, Marked: marked})
+}
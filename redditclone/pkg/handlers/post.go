@@ -7,9 +7,15 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"redditclone/pkg/automod"
+	"redditclone/pkg/community"
+	"redditclone/pkg/live"
+	"redditclone/pkg/moderation"
+	"redditclone/pkg/policy"
 	post "redditclone/pkg/posts"
 	"redditclone/pkg/session"
-	"sort"
+	"redditclone/pkg/user"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,8 +23,15 @@ import (
 )
 
 type PostHandler struct {
-	Repo   post.PostRepo
-	Logger *zap.SugaredLogger
+	Repo        post.PostRepo
+	Communities community.CommunityRepo
+	Users       user.UserRepo
+	Policy      *policy.Policy
+	ModLog      moderation.ModLogRepo
+	Reports     moderation.ReportRepo
+	AutoMod     *automod.CachedRepo
+	Live        *live.Hub
+	Logger      *zap.SugaredLogger
 }
 
 type RequestForm struct {
@@ -34,6 +47,8 @@ var ErrJSONMarshal = errors.New("json marshal error")
 var ErrSessionNotFound = errors.New("session not found")
 var ErrReadReqBody = errors.New("read request body error")
 var ErrJSONUnmarshal = errors.New("json unmarshal error")
+var ErrBadQuery = errors.New("bad query parameter")
+var ErrCannotPost = errors.New("not allowed to post in this community")
 
 var HexIDSize = 12
 
@@ -54,6 +69,89 @@ func (handler *PostHandler) generateHexID() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+func viewerID(r *http.Request) string {
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		return ""
+	}
+	return sess.UserID
+}
+
+// getPost loads a post the requesting user may see; posts of private
+// communities are not found for outsiders, and posts held for review only
+// by their author and the moderators.
+func (handler *PostHandler) getPost(r *http.Request, postID string) (*post.Post, error) {
+	currentPost, err := handler.Repo.GetPost(postID)
+	if err != nil {
+		return nil, err
+	}
+	if currentPost.Filtered && !handler.canSeeHeld(viewerID(r), currentPost) {
+		return nil, post.ErrPostNotFound
+	}
+
+	c, err := handler.Communities.GetCommunity(currentPost.Category)
+	if errors.Is(err, community.ErrCommunityNotFound) {
+		return currentPost, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !c.CanView(viewerID(r)) {
+		return nil, post.ErrPostNotFound
+	}
+	return currentPost, nil
+}
+
+func (handler *PostHandler) canSeeHeld(userID string, p *post.Post) bool {
+	if userID == "" {
+		return false
+	}
+	if userID == p.Author.ID {
+		return true
+	}
+	u, err := handler.Users.GetUserByID(userID)
+	if err != nil {
+		return false
+	}
+	return handler.Policy.CanModerate(u, p.Category) == nil
+}
+
+// checkCanPost returns the status and error to answer with when the user
+// cannot submit to the community.
+func (handler *PostHandler) checkCanPost(name, userID string) (int, error) {
+	c, err := handler.Communities.GetCommunity(name)
+	if errors.Is(err, community.ErrCommunityNotFound) {
+		return http.StatusBadRequest, ErrWrongCategory
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !c.CanPost(userID) {
+		if !c.CanView(userID) {
+			return http.StatusBadRequest, ErrWrongCategory
+		}
+		return http.StatusForbidden, ErrCannotPost
+	}
+	return http.StatusOK, nil
+}
+
+// hiddenCommunities lists the private communities the user is not a member
+// of, which site-wide listings leave out.
+func (handler *PostHandler) hiddenCommunities(userID string) ([]string, error) {
+	communities, err := handler.Communities.GetAllCommunities()
+	if err != nil {
+		return nil, err
+	}
+
+	hidden := make([]string, 0)
+	for _, c := range communities {
+		if !c.CanView(userID) {
+			hidden = append(hidden, c.Name)
+		}
+	}
+	return hidden, nil
+}
+
 func (handler *PostHandler) SendPost(w http.ResponseWriter, currentPost post.Post) error {
 	resp, err := json.Marshal(currentPost)
 	if err != nil {
@@ -96,6 +194,12 @@ func (handler *PostHandler) AddPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if status, err := handler.checkCanPost(rf.Category, sess.UserID); err != nil {
+		http.Error(w, err.Error(), status)
+		handler.Logger.Error(err)
+		return
+	}
+
 	postID, err := handler.generateHexID()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -138,9 +242,28 @@ func (handler *PostHandler) AddPost(w http.ResponseWriter, r *http.Request) {
 
 	currentPost.Votes = append(currentPost.Votes, &post.Vote{UserID: sess.UserID, Vote: post.UpvoteValue})
 
+	outcome, err := handler.automoderate(currentPost.Category, sess.UserID, &automod.Subject{
+		Kind: automod.KindPost, Title: currentPost.Title, Body: currentPost.Text, URL: currentPost.URL})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	if outcome.Remove {
+		handler.sendAutoRemoved(w, currentPost.Category, outcome, &moderation.Action{
+			Action:  moderation.ActionRemovePost,
+			Author:  currentPost.Author.Username,
+			Details: currentPost.Title,
+		})
+		return
+	}
+	currentPost.Flair = outcome.Flair
+	currentPost.Locked = outcome.Lock
+	currentPost.Filtered = outcome.Filter
+
 	err = handler.Repo.AddPost(&currentPost)
 	if err != nil {
-		http.Error(w, ErrWrongCategory.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		handler.Logger.Error(err)
 		return
 	}
@@ -152,6 +275,22 @@ func (handler *PostHandler) AddPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(outcome.Rules) > 0 {
+		// the post was stored locked already, so applyOutcome has no lock
+		// left to log
+		if currentPost.Locked {
+			handler.recordAutoLock(&currentPost)
+		}
+		handler.applyOutcome(outcome, &currentPost, nil)
+		stored, err := handler.Repo.GetPost(currentPost.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			handler.Logger.Error(err)
+			return
+		}
+		currentPost = *stored
+	}
+
 	err = handler.SendPost(w, currentPost)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -160,10 +299,21 @@ func (handler *PostHandler) AddPost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// sortComments returns the post with its comments in the requested order,
+// leaving the stored post untouched. An empty mode keeps the stored order.
+func (handler *PostHandler) sortComments(currentPost post.Post, mode string) (post.Post, error) {
+	if mode == "" {
+		return currentPost, nil
+	}
+	currentPost.Comments = append([]*post.Comment(nil), currentPost.Comments...)
+	err := post.SortComments(currentPost.Comments, mode)
+	return currentPost, err
+}
+
 func (handler *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	postID := strings.Replace(r.URL.Path, "/api/post/", "", 1)
 
-	currentPost, err := handler.Repo.GetPost(postID)
+	currentPost, err := handler.getPost(r, postID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		handler.Logger.Error(err)
@@ -172,7 +322,14 @@ func (handler *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 
 	handler.Repo.AddViews(currentPost)
 
-	resp, err := json.Marshal(currentPost)
+	sortedPost, err := handler.sortComments(*currentPost, r.URL.Query().Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	resp, err := json.Marshal(sortedPost)
 	if err != nil {
 		http.Error(w, ErrJSONMarshal.Error(), http.StatusInternalServerError)
 		handler.Logger.Error(err)
@@ -192,24 +349,78 @@ func (handler *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func (handler *PostHandler) sortPostsAndSend(w http.ResponseWriter, currentPosts map[string]*post.Post) {
+// listQuery reads the listing parameters: sort and t select the order,
+// after or before continue from a cursor and limit sets the page size.
+func (handler *PostHandler) listQuery(r *http.Request) (post.ListQuery, error) {
+	query := r.URL.Query()
+	q := post.ListQuery{
+		Rank: post.RankOptions{
+			Sort:   query.Get("sort"),
+			Window: query.Get("t"),
+		},
+		After:  query.Get("after"),
+		Before: query.Get("before"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return q, ErrBadQuery
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
 
-	posts := make([]*post.Post, 0)
+// pageLink is the URL of the listing page next to the current one.
+func pageLink(r *http.Request, param, cursor string) string {
+	u := *r.URL
+	query := u.Query()
+	query.Del("after")
+	query.Del("before")
+	query.Set(param, cursor)
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
 
-	for _, val := range currentPosts {
-		posts = append(posts, val)
+func (handler *PostHandler) listPostsAndSend(w http.ResponseWriter, r *http.Request, q post.ListQuery) {
+	listing, err := handler.Repo.ListPosts(q)
+	if errors.Is(err, post.ErrBadCursor) || errors.Is(err, post.ErrUnknownSort) ||
+		errors.Is(err, post.ErrUnknownTimeWindow) || errors.Is(err, post.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
 	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendListing(w, r, listing)
+}
 
-	sort.Slice(posts, func(i, j int) bool {
-		return len(posts[i].Comments) < len(posts[j].Comments)
-	})
-
-	resp, err := json.Marshal(posts)
+// sendListing writes one page of posts as a JSON array. The cursors of the
+// neighbouring pages go to the X-Cursor-After and X-Cursor-Before headers
+// and to the Link header.
+func (handler *PostHandler) sendListing(w http.ResponseWriter, r *http.Request, listing *post.Listing) {
+	resp, err := json.Marshal(listing.Posts)
 	if err != nil {
 		http.Error(w, ErrJSONMarshal.Error(), http.StatusInternalServerError)
 		handler.Logger.Error(err)
 		return
 	}
+
+	links := make([]string, 0, 2)
+	if listing.After != "" {
+		w.Header().Set("X-Cursor-After", listing.After)
+		links = append(links, "<"+pageLink(r, "after", listing.After)+`>; rel="next"`)
+	}
+	if listing.Before != "" {
+		w.Header().Set("X-Cursor-Before", listing.Before)
+		links = append(links, "<"+pageLink(r, "before", listing.Before)+`>; rel="prev"`)
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 
@@ -222,24 +433,75 @@ func (handler *PostHandler) sortPostsAndSend(w http.ResponseWriter, currentPosts
 }
 
 func (handler *PostHandler) GetAllPosts(w http.ResponseWriter, r *http.Request) {
+	q, err := handler.listQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	q.Exclude, err = handler.hiddenCommunities(viewerID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
 
-	currentPosts := handler.Repo.GetAllPosts()
-	handler.sortPostsAndSend(w, currentPosts)
-
+	handler.listPostsAndSend(w, r, q)
 }
 
-func (handler *PostHandler) GetPostsWithCategory(w http.ResponseWriter, r *http.Request) {
+// GetHomePosts lists the posts of the communities the user subscribed to.
+// Anonymous visitors and users without subscriptions get the global listing.
+func (handler *PostHandler) GetHomePosts(w http.ResponseWriter, r *http.Request) {
+	q, err := handler.listQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	userID := viewerID(r)
+	if userID != "" {
+		subscriptions, err := handler.Communities.GetSubscriptions(userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			handler.Logger.Error(err)
+			return
+		}
+		if len(subscriptions) > 0 {
+			q.Categories = subscriptions
+		}
+	}
 
-	category := strings.Replace(r.URL.Path, "/api/posts/", "", 1)
+	q.Exclude, err = handler.hiddenCommunities(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
 
-	currentPosts, err := handler.Repo.GetPostsWithCategory(category)
+	handler.listPostsAndSend(w, r, q)
+}
+
+func (handler *PostHandler) GetPostsWithCategory(w http.ResponseWriter, r *http.Request) {
+	q, err := handler.listQuery(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		handler.Logger.Error(err)
 		return
 	}
+	q.Category = strings.Replace(r.URL.Path, "/api/posts/", "", 1)
 
-	handler.sortPostsAndSend(w, currentPosts)
+	c, err := handler.Communities.GetCommunity(q.Category)
+	if err == nil && !c.CanView(viewerID(r)) {
+		err = community.ErrCommunityNotFound
+	}
+	if err != nil {
+		http.Error(w, ErrWrongCategory.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	handler.listPostsAndSend(w, r, q)
 }
 
 type CommentRequest struct {
@@ -286,7 +548,17 @@ func (handler *PostHandler) SendAddCommentError(w http.ResponseWriter) {
 func (handler *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	handler.Logger.Info("add comment")
 	postID := strings.Replace(r.URL.Path, "/api/post/", "", 1)
-	currentPost, err := handler.Repo.GetPost(postID)
+	handler.addComment(w, r, postID, "")
+}
+
+func (handler *PostHandler) ReplyComment(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("reply comment")
+	pathSegments := strings.Split(r.URL.Path, "/")[1:]
+	handler.addComment(w, r, pathSegments[2], pathSegments[3])
+}
+
+func (handler *PostHandler) addComment(w http.ResponseWriter, r *http.Request, postID, parentID string) {
+	currentPost, err := handler.getPost(r, postID)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -301,6 +573,20 @@ func (handler *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if currentPost.Locked {
+		u, err := actor(r, handler.Users)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			handler.Logger.Error(err)
+			return
+		}
+		if err = handler.Policy.CanModerate(u, currentPost.Category); err != nil {
+			http.Error(w, ErrPostLocked.Error(), http.StatusForbidden)
+			handler.Logger.Error(ErrPostLocked)
+			return
+		}
+	}
+
 	reqBody, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -332,14 +618,44 @@ func (handler *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 		UserAuthor:  post.Author{Username: sess.UserName, ID: sess.UserID},
 		CreatedTime: handler.makeFormDate(),
 		ID:          commentID,
+		ParentID:    parentID,
+		Votes:       make([]*post.Vote, 0),
 	}
 
+	outcome, err := handler.automoderate(currentPost.Category, sess.UserID, &automod.Subject{
+		Kind: automod.KindComment, Body: currentComment.Body})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	if outcome.Remove {
+		handler.sendAutoRemoved(w, currentPost.Category, outcome, &moderation.Action{
+			Action:  moderation.ActionRemoveComment,
+			PostID:  currentPost.ID,
+			Author:  currentComment.UserAuthor.Username,
+			Details: currentComment.Body,
+		})
+		return
+	}
+	currentComment.Filtered = outcome.Filter
+
 	err = handler.Repo.AddCommentToPost(currentPost.ID, &currentComment)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		handler.Logger.Error(err)
 		return
 	}
+	if len(outcome.Rules) > 0 {
+		handler.applyOutcome(outcome, currentPost, &currentComment)
+	}
+
+	currentPost, err = handler.getPost(r, postID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
 	err = handler.SendPost(w, *currentPost)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -353,7 +669,7 @@ func (handler *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 
 func (handler *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	handler.Logger.Info("delete comment")
-	sess, err := session.GetSessionFromContext(r.Context())
+	u, err := actor(r, handler.Users)
 	if err != nil {
 		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
 		handler.Logger.Error(err)
@@ -365,19 +681,42 @@ func (handler *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request
 	postID := pathSegments[2]
 	commentID := pathSegments[3]
 	handler.Logger.Info(postID)
-	currentPost, err := handler.Repo.GetPost(postID)
+	currentPost, err := handler.getPost(r, postID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		handler.Logger.Error(err)
 		return
 	}
 
-	err = handler.Repo.DeleteComment(currentPost, commentID, sess.UserID)
+	comm, err := currentPost.GetComment(commentID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		handler.Logger.Error(err)
 		return
 	}
+
+	asModerator, err := handler.Policy.CanRemove(u, currentPost.Category, comm.UserAuthor.ID)
+	if err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	action := &moderation.Action{
+		Action:    moderation.ActionRemoveComment,
+		PostID:    currentPost.ID,
+		CommentID: comm.ID,
+		Author:    comm.UserAuthor.Username,
+		Details:   comm.Body,
+	}
+	err = handler.Repo.DeleteComment(currentPost, commentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	if asModerator {
+		handler.recordAction(u, currentPost.Category, action)
+	}
 	err = handler.SendPost(w, *currentPost)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -402,14 +741,18 @@ func (handler *PostHandler) Upvote(w http.ResponseWriter, r *http.Request) {
 
 	currentVote := &post.Vote{UserID: sess.UserID, Vote: post.UpvoteValue}
 
-	currentPost, err := handler.Repo.GetPost(postID)
+	currentPost, err := handler.getPost(r, postID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		handler.Logger.Error(err)
 		return
 	}
 
-	handler.Repo.AddVote(currentPost, currentVote, post.UpvoteValue)
+	if err = handler.Repo.AddVote(currentPost, currentVote, post.UpvoteValue); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
 	err = handler.SendPost(w, *currentPost)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -435,14 +778,18 @@ func (handler *PostHandler) Downvote(w http.ResponseWriter, r *http.Request) {
 
 	currentVote := &post.Vote{UserID: sess.UserID, Vote: post.DownvoteValue}
 
-	currentPost, err := handler.Repo.GetPost(postID)
+	currentPost, err := handler.getPost(r, postID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		handler.Logger.Error(err)
 		return
 	}
 
-	handler.Repo.AddVote(currentPost, currentVote, post.DownvoteValue)
+	if err = handler.Repo.AddVote(currentPost, currentVote, post.DownvoteValue); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
 	err = handler.SendPost(w, *currentPost)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -466,7 +813,7 @@ func (handler *PostHandler) Unvote(w http.ResponseWriter, r *http.Request) {
 
 	postID := pathSegments[2]
 
-	currentPost, err := handler.Repo.GetPost(postID)
+	currentPost, err := handler.getPost(r, postID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		handler.Logger.Error(err)
@@ -495,7 +842,7 @@ type DeletePostResponse struct {
 
 func (handler *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	handler.Logger.Info("delete post")
-	sess, err := session.GetSessionFromContext(r.Context())
+	u, err := actor(r, handler.Users)
 	if err != nil {
 		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
 		handler.Logger.Error(err)
@@ -506,7 +853,7 @@ func (handler *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 
 	postID := pathSegments[2]
 
-	currentPost, err := handler.Repo.GetPost(postID)
+	currentPost, err := handler.getPost(r, postID)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -514,12 +861,26 @@ func (handler *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = handler.Repo.DeletePost(currentPost, sess.UserName, sess.UserID)
+	asModerator, err := handler.Policy.CanRemove(u, currentPost.Category, currentPost.Author.ID)
+	if err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	err = handler.Repo.DeletePost(currentPost)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		handler.Logger.Error(err)
 		return
 	}
+	if asModerator {
+		handler.recordAction(u, currentPost.Category, &moderation.Action{
+			Action:  moderation.ActionRemovePost,
+			PostID:  currentPost.ID,
+			Author:  currentPost.Author.Username,
+			Details: currentPost.Title,
+		})
+	}
 	resp, err := json.Marshal(DeletePostResponse{Message: "success"})
 	if err != nil {
 		http.Error(w, ErrJSONMarshal.Error(), http.StatusInternalServerError)
@@ -543,16 +904,135 @@ func (handler *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 func (handler *PostHandler) GetUserPosts(w http.ResponseWriter, r *http.Request) {
 	handler.Logger.Info("get userPosts")
 	pathSegments := strings.Split(r.URL.Path, "/")[1:]
-	userName := pathSegments[2]
 
-	posts, err := handler.Repo.GetUserPosts(userName)
+	q, err := handler.listQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	q.Author = pathSegments[2]
+	if q.Rank.Sort == "" {
+		q.Rank.Sort = post.PostSortNew
+	}
+	q.Exclude, err = handler.hiddenCommunities(viewerID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	handler.listPostsAndSend(w, r, q)
+	handler.Logger.Infow("success")
+}
+
+type EditForm struct {
+	Category *string `json:"category"`
+	Text     *string `json:"text"`
+	URL      *string `json:"url"`
+}
+
+func (handler *PostHandler) EditPost(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("edit post")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	postID := strings.Replace(r.URL.Path, "/api/post/", "", 1)
+
+	currentPost, err := handler.getPost(r, postID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	js, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, ErrReadReqBody.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	ef := &EditForm{}
+	err = json.Unmarshal(js, ef)
+	if err != nil {
+		http.Error(w, ErrJSONUnmarshal.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	if ef.Category != nil && *ef.Category != currentPost.Category {
+		if status, err := handler.checkCanPost(*ef.Category, sess.UserID); err != nil {
+			http.Error(w, err.Error(), status)
+			handler.Logger.Error(err)
+			return
+		}
+	}
+
+	edit := &post.PostEdit{Text: ef.Text, URL: ef.URL, Category: ef.Category}
+	err = handler.Repo.EditPost(currentPost, edit, sess.UserID, handler.makeFormDate())
+	if errors.Is(err, post.ErrAccessDenied) {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	// the edited post goes through the rules of its community like a new one
+	outcome, err := handler.automoderate(currentPost.Category, sess.UserID, &automod.Subject{
+		Kind: automod.KindPost, Title: currentPost.Title, Body: currentPost.Text, URL: currentPost.URL})
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	if len(outcome.Rules) > 0 {
+		handler.applyOutcome(outcome, currentPost, nil)
+		if outcome.Remove {
+			http.Error(w, "removed by "+automod.Name+": "+outcome.Reason, http.StatusForbidden)
+			handler.Logger.Infow("edited post removed by automoderator",
+				"postID", postID)
+			return
+		}
+		if currentPost, err = handler.Repo.GetPost(postID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			handler.Logger.Error(err)
+			return
+		}
+	}
+
+	writeJSON(w, handler.Logger, http.StatusOK, currentPost)
+	handler.Logger.Infow("post edited",
+		"postID", postID)
+}
+
+func (handler *PostHandler) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get revisions")
+	pathSegments := strings.Split(r.URL.Path, "/")[1:]
+	postID := pathSegments[2]
+
+	if _, err := handler.getPost(r, postID); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		handler.Logger.Error(err)
 		return
 	}
 
-	resp, err := json.Marshal(posts)
+	revisions, err := handler.Repo.GetRevisions(postID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	resp, err := json.Marshal(revisions)
 	if err != nil {
 		http.Error(w, ErrJSONMarshal.Error(), http.StatusInternalServerError)
 		handler.Logger.Error(err)
@@ -567,5 +1047,114 @@ func (handler *PostHandler) GetUserPosts(w http.ResponseWriter, r *http.Request)
 		handler.Logger.Error(errWrite)
 		return
 	}
-	handler.Logger.Infow("success")
+}
+
+func (handler *PostHandler) GetCommentTree(w http.ResponseWriter, r *http.Request) {
+	pathSegments := strings.Split(r.URL.Path, "/")[1:]
+	postID := pathSegments[2]
+
+	depth := post.DefaultCommentTreeDepth
+	if val := r.URL.Query().Get("depth"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 1 {
+			http.Error(w, ErrBadQuery.Error(), http.StatusBadRequest)
+			handler.Logger.Error(err)
+			return
+		}
+		depth = min(parsed, post.MaxCommentTreeDepth)
+	}
+
+	currentPost, err := handler.getPost(r, postID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	sortedPost, err := handler.sortComments(*currentPost, r.URL.Query().Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	tree, err := post.BuildCommentTree(post.VisibleComments(sortedPost.Comments), r.URL.Query().Get("parent"), depth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	resp, err := json.Marshal(tree)
+	if err != nil {
+		http.Error(w, ErrJSONMarshal.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	_, errWrite := w.Write(resp)
+	if errWrite != nil {
+		http.Error(w, errWrite.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(errWrite)
+		return
+	}
+}
+
+func (handler *PostHandler) voteComment(w http.ResponseWriter, r *http.Request, voteValue int) {
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	pathSegments := strings.Split(r.URL.Path, "/")[1:]
+
+	postID := pathSegments[2]
+	commentID := pathSegments[3]
+
+	currentPost, err := handler.getPost(r, postID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	if voteValue == 0 {
+		err = handler.Repo.DeleteCommentVote(currentPost, commentID, sess.UserID)
+	} else {
+		err = handler.Repo.AddCommentVote(currentPost, commentID, &post.Vote{UserID: sess.UserID, Vote: voteValue})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	err = handler.SendPost(w, *currentPost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.Logger.Infow("success",
+		"postID", postID,
+		"commentID", commentID)
+}
+
+func (handler *PostHandler) UpvoteComment(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("upvote comment")
+	handler.voteComment(w, r, post.UpvoteValue)
+}
+
+func (handler *PostHandler) DownvoteComment(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("downvote comment")
+	handler.voteComment(w, r, post.DownvoteValue)
+}
+
+func (handler *PostHandler) UnvoteComment(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("unvote comment")
+	handler.voteComment(w, r, 0)
 }
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"redditclone/pkg/community"
+	"redditclone/pkg/moderation"
+	post "redditclone/pkg/posts"
+	"redditclone/pkg/user"
+	"strings"
+	"unicode/utf8"
+)
+
+type ReportForm struct {
+	Reason string `json:"reason"`
+}
+
+type DecisionForm struct {
+	PostID    string `json:"postId"`
+	CommentID string `json:"commentId"`
+	Decision  string `json:"decision"`
+}
+
+type DecisionResponse struct {
+	Decision string `json:"decision"`
+	Resolved int    `json:"resolved"`
+}
+
+func readReason(r *http.Request) (string, error) {
+	js, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		return "", ErrReadReqBody
+	}
+	rf := &ReportForm{}
+	if err = json.Unmarshal(js, rf); err != nil {
+		return "", ErrJSONUnmarshal
+	}
+	reason := strings.TrimSpace(rf.Reason)
+	if reason == "" || utf8.RuneCountInString(reason) > moderation.MaxReasonLength {
+		return "", moderation.ErrBadReason
+	}
+	return reason, nil
+}
+
+// ReportPost flags a post for the moderators of its community.
+func (handler *PostHandler) ReportPost(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("report post")
+	pathSegments := strings.Split(r.URL.Path, "/")[1:]
+	handler.report(w, r, pathSegments[2], "")
+}
+
+// ReportComment flags a comment for the moderators of the community.
+func (handler *PostHandler) ReportComment(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("report comment")
+	pathSegments := strings.Split(r.URL.Path, "/")[1:]
+	handler.report(w, r, pathSegments[2], pathSegments[3])
+}
+
+func (handler *PostHandler) report(w http.ResponseWriter, r *http.Request, postID, commentID string) {
+	u, err := actor(r, handler.Users)
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	currentPost, err := handler.getPost(r, postID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	details := currentPost.Title
+	if commentID != "" {
+		comm, err := currentPost.GetComment(commentID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			handler.Logger.Error(err)
+			return
+		}
+		details = comm.Body
+	}
+
+	reason, err := readReason(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	id, err := handler.generateHexID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	err = handler.Reports.AddReport(&moderation.Report{
+		ID:        id,
+		Community: currentPost.Category,
+		PostID:    currentPost.ID,
+		CommentID: commentID,
+		Reporter:  community.Member{Username: u.Name, ID: u.ID},
+		Reason:    reason,
+		Details:   details,
+		Created:   handler.makeFormDate(),
+	})
+	if errors.Is(err, moderation.ErrAlreadyReported) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	handler.automoderateReport(currentPost, commentID)
+
+	writeJSON(w, handler.Logger, http.StatusCreated, DeletePostResponse{Message: "success"})
+	handler.Logger.Infow("content reported",
+		"postID", postID, "commentID", commentID, "reporter", u.Name)
+}
+
+// moderatedCommunity loads the community in the path for one of its
+// moderators; the error response is already sent when ok is false.
+func (handler *PostHandler) moderatedCommunity(w http.ResponseWriter, r *http.Request) (*user.User, string, bool) {
+	u, err := actor(r, handler.Users)
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return nil, "", false
+	}
+
+	name := strings.Split(r.URL.Path, "/")[3]
+	_, err = handler.Communities.GetCommunity(name)
+	if errors.Is(err, community.ErrCommunityNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return nil, "", false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return nil, "", false
+	}
+
+	if err = handler.Policy.CanModerate(u, name); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return nil, "", false
+	}
+	return u, name, true
+}
+
+// GetModQueue lists the reported posts and comments of the community.
+func (handler *PostHandler) GetModQueue(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get modqueue")
+	_, name, ok := handler.moderatedCommunity(w, r)
+	if !ok {
+		return
+	}
+
+	queue, err := handler.Reports.GetQueue(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	writeJSON(w, handler.Logger, http.StatusOK, queue)
+}
+
+// ResolveQueueItem applies a moderator decision to a reported item: approve
+// keeps the content, remove deletes it and dismiss drops the reports.
+// Content the automoderator held back is released by approve and dismiss.
+func (handler *PostHandler) ResolveQueueItem(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("resolve modqueue item")
+	u, name, ok := handler.moderatedCommunity(w, r)
+	if !ok {
+		return
+	}
+
+	js, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, ErrReadReqBody.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	df := &DecisionForm{}
+	if err = json.Unmarshal(js, df); err != nil {
+		http.Error(w, ErrJSONUnmarshal.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	if !moderation.IsDecision(df.Decision) {
+		http.Error(w, moderation.ErrUnknownDecision.Error(), http.StatusBadRequest)
+		handler.Logger.Error(moderation.ErrUnknownDecision)
+		return
+	}
+
+	item, err := handler.queuedItem(name, df.PostID, df.CommentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	if item == nil {
+		http.Error(w, moderation.ErrReportNotFound.Error(), http.StatusNotFound)
+		handler.Logger.Error(moderation.ErrReportNotFound)
+		return
+	}
+
+	action, err := handler.decide(item, df.Decision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	n, err := handler.Reports.ResolveReports(name, df.PostID, df.CommentID, df.Decision)
+	if errors.Is(err, moderation.ErrReportNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.recordAction(u, name, action)
+
+	writeJSON(w, handler.Logger, http.StatusOK, DecisionResponse{Decision: df.Decision, Resolved: n})
+}
+
+func (handler *PostHandler) queuedItem(name, postID, commentID string) (*moderation.QueueItem, error) {
+	queue, err := handler.Reports.GetQueue(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range queue {
+		if item.PostID == postID && item.CommentID == commentID {
+			return item, nil
+		}
+	}
+	return nil, nil
+}
+
+// decide carries out the decision on the reported content and returns the
+// modlog entry for it. Content that is already gone can still be removed or
+// have its reports dismissed, which only closes the reports.
+func (handler *PostHandler) decide(item *moderation.QueueItem, decision string) (*moderation.Action, error) {
+	action := &moderation.Action{PostID: item.PostID, CommentID: item.CommentID, Details: item.Details}
+
+	currentPost, err := handler.Repo.GetPost(item.PostID)
+	if err == nil && currentPost.Category != item.Community {
+		err = post.ErrPostNotFound
+	}
+	if err == nil {
+		action.Author = currentPost.Author.Username
+		if item.CommentID != "" {
+			var comm *post.Comment
+			comm, err = currentPost.GetComment(item.CommentID)
+			if err == nil {
+				action.Author = comm.UserAuthor.Username
+			}
+		}
+	}
+	gone := errors.Is(err, post.ErrPostNotFound) || errors.Is(err, post.ErrCommentNotFound)
+	if err != nil && (!gone || decision == moderation.DecisionApprove) {
+		return nil, err
+	}
+	err = nil
+
+	switch {
+	case decision == moderation.DecisionDismiss:
+		action.Action = moderation.ActionDismissReports
+		if !gone {
+			err = handler.release(currentPost, item.CommentID)
+		}
+	case decision == moderation.DecisionApprove && item.CommentID != "":
+		action.Action = moderation.ActionApproveComment
+		err = handler.release(currentPost, item.CommentID)
+	case decision == moderation.DecisionApprove:
+		action.Action = moderation.ActionApprovePost
+		err = handler.release(currentPost, "")
+	case item.CommentID != "":
+		action.Action = moderation.ActionRemoveComment
+		if !gone {
+			err = handler.Repo.DeleteComment(currentPost, item.CommentID)
+		}
+	default:
+		action.Action = moderation.ActionRemovePost
+		if !gone {
+			err = handler.Repo.DeletePost(currentPost)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// release shows content the automoderator held back again.
+func (handler *PostHandler) release(p *post.Post, commentID string) error {
+	filtered := p.Filtered
+	if commentID != "" {
+		comm, err := p.GetComment(commentID)
+		if err != nil {
+			return err
+		}
+		filtered = comm.Filtered
+	}
+	if !filtered {
+		return nil
+	}
+	return handler.Repo.SetFiltered(p, commentID, false)
+}
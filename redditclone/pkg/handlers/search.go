@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	post "redditclone/pkg/posts"
+	"strconv"
+	"time"
+)
+
+const searchDateLayout = "2006-01-02"
+
+// parseSearchDate accepts RFC 3339 times and plain dates. A plain date used
+// as the upper bound includes the whole day.
+func parseSearchDate(value string, upper bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(searchDateLayout, value)
+	if err != nil {
+		return time.Time{}, ErrBadQuery
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func (handler *PostHandler) searchQuery(r *http.Request) (post.SearchQuery, error) {
+	query := r.URL.Query()
+	q := post.SearchQuery{
+		Text:     query.Get("q"),
+		Category: query.Get("category"),
+		Author:   query.Get("author"),
+		Type:     query.Get("type"),
+		Sort:     query.Get("sort"),
+		After:    query.Get("after"),
+		Before:   query.Get("before"),
+	}
+
+	var err error
+	if q.From, err = parseSearchDate(query.Get("from"), false); err != nil {
+		return q, err
+	}
+	if q.To, err = parseSearchDate(query.Get("to"), true); err != nil {
+		return q, err
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return q, ErrBadQuery
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// Search finds posts by the words of their title, text, url and comments.
+func (handler *PostHandler) Search(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("search")
+	q, err := handler.searchQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	q.Exclude, err = handler.hiddenCommunities(viewerID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	listing, err := handler.Repo.SearchPosts(q)
+	if errors.Is(err, post.ErrEmptySearch) || errors.Is(err, post.ErrUnknownSort) || errors.Is(err, post.ErrBadCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendListing(w, r, listing)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"redditclone/pkg/session"
+	"strings"
+	"time"
+)
+
+type SessionInfo struct {
+	ID       string `json:"id"`
+	Device   string `json:"device"`
+	IP       string `json:"ip"`
+	Created  string `json:"created"`
+	LastSeen string `json:"lastSeen"`
+	Current  bool   `json:"current"`
+}
+
+type RevokeSessionsResponse struct {
+	Message string `json:"message"`
+	Revoked int    `json:"revoked"`
+}
+
+func (handler *UserHandler) sendJSON(w http.ResponseWriter, status int, data interface{}) {
+	resp, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, ErrJSONMarshal.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	_, errWrite := w.Write(resp)
+	if errWrite != nil {
+		http.Error(w, errWrite.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(errWrite)
+		return
+	}
+}
+
+func (handler *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("/logout")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	err = handler.Sessions.DestroyUserSession(sess.UserID, sess.Handle)
+	if err != nil && !errors.Is(err, session.ErrSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.Sessions.ClearCookie(w)
+
+	handler.sendJSON(w, http.StatusOK, map[string]string{"message": "success"})
+	handler.Logger.Infow("user logout",
+		"ID", sess.UserID,
+		"session", sess.Handle)
+}
+
+func (handler *UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("list sessions")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	sessions, err := handler.Sessions.ListSessions(sess.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, SessionInfo{
+			ID:       s.Handle,
+			Device:   s.UserAgent,
+			IP:       s.IP,
+			Created:  s.CreatedAt.UTC().Format(time.RFC3339Nano),
+			LastSeen: s.LastSeen.UTC().Format(time.RFC3339Nano),
+			Current:  s.ID == sess.ID,
+		})
+	}
+
+	handler.sendJSON(w, http.StatusOK, infos)
+}
+
+func (handler *UserHandler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("revoke all sessions")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	revoked, err := handler.Sessions.DestroyAllSessions(sess.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.Sessions.ClearCookie(w)
+
+	handler.sendJSON(w, http.StatusOK, RevokeSessionsResponse{Message: "success", Revoked: revoked})
+	handler.Logger.Infow("all sessions revoked",
+		"ID", sess.UserID,
+		"revoked", revoked)
+}
+
+func (handler *UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("revoke session")
+	sess, err := session.GetSessionFromContext(r.Context())
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+
+	handle := strings.Replace(r.URL.Path, "/api/sessions/", "", 1)
+
+	err = handler.Sessions.DestroyUserSession(sess.UserID, handle)
+	if errors.Is(err, session.ErrSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	if handle == sess.Handle {
+		handler.Sessions.ClearCookie(w)
+	}
+
+	handler.sendJSON(w, http.StatusOK, RevokeSessionsResponse{Message: "success", Revoked: 1})
+	handler.Logger.Infow("session revoked",
+		"ID", sess.UserID,
+		"session", handle)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"redditclone/pkg/community"
+	"redditclone/pkg/live"
+	"time"
+)
+
+var ErrStreamUnsupported = errors.New("streaming unsupported")
+
+// StreamHeartbeat keeps idle streams from being closed by proxies.
+var StreamHeartbeat = 25 * time.Second
+
+// streamFilter reads which events the client wants: those of one post, of
+// one category, or all of them. Posts and categories the user may not see
+// are not found.
+func (handler *PostHandler) streamFilter(r *http.Request, userID string) (live.Filter, error) {
+	f := live.Filter{PostID: r.URL.Query().Get("post"), Category: r.URL.Query().Get("category")}
+
+	if f.PostID != "" {
+		if _, err := handler.getPost(r, f.PostID); err != nil {
+			return f, err
+		}
+	}
+	if f.Category != "" {
+		c, err := handler.Communities.GetCommunity(f.Category)
+		if err == nil && !c.CanView(userID) {
+			err = community.ErrCommunityNotFound
+		}
+		if err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// canViewEvent tells whether the user may see an event right now: joining
+// or leaving a private community, or a ban, applies to open streams too.
+func (handler *PostHandler) canViewEvent(userID string, e *live.Event) (bool, error) {
+	c, err := handler.Communities.GetCommunity(e.Category)
+	if errors.Is(err, community.ErrCommunityNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return c.CanView(userID), nil
+}
+
+// Stream sends live changes of posts as server-sent events until the client
+// goes away. Each event is named by its type and carries the JSON of a
+// live.Event.
+func (handler *PostHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("stream")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, ErrStreamUnsupported.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(ErrStreamUnsupported)
+		return
+	}
+
+	userID := viewerID(r)
+	f, err := handler.streamFilter(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	sub := handler.Live.Subscribe(f)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(StreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			handler.Logger.Infow("stream closed",
+				"post", f.PostID, "category", f.Category, "dropped", sub.Dropped())
+			return
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				handler.Logger.Error(err)
+				return
+			}
+		case e := <-sub.Events:
+			visible, err := handler.canViewEvent(userID, &e)
+			if err != nil {
+				handler.Logger.Error(err)
+				continue
+			}
+			if !visible {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				handler.Logger.Error(err)
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				handler.Logger.Error(err)
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
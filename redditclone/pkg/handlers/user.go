@@ -4,20 +4,32 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"redditclone/pkg/automod"
+	"redditclone/pkg/moderation"
+	"redditclone/pkg/notifications"
+	"redditclone/pkg/policy"
 	"redditclone/pkg/session"
+	"redditclone/pkg/token"
 	"redditclone/pkg/user"
+	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"go.uber.org/zap"
 )
 
 type UserHandler struct {
-	Repo     user.UserRepo
-	Sessions *session.SessionManager
-	Logger   *zap.SugaredLogger
+	Repo          user.UserRepo
+	Sessions      *session.SessionManager
+	Tokens        *token.Manager
+	Policy        *policy.Policy
+	Bans          moderation.BanRepo
+	Notifications notifications.Repo
+	// Admins are user names that get the admin role when they register.
+	Admins map[string]bool
+	Logger *zap.SugaredLogger
 }
 
 type LoginForm struct {
@@ -25,8 +37,6 @@ type LoginForm struct {
 	Password string `json:"password"`
 }
 
-var TokenSecret = []byte("nyEJB9GIy9aiwcRh")
-
 func GenerateHexID() (string, error) {
 	bytes := make([]byte, 12)
 	_, err := rand.Read(bytes)
@@ -51,19 +61,8 @@ func (handler *UserHandler) parseLoginForm(r *http.Request) (*LoginForm, error)
 	return lf, nil
 }
 
-func (handler *UserHandler) createJWT(user *user.User, now int64) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user": map[string]string{"username": user.Name, "id": user.ID},
-		"iat":  now,
-		"exp":  time.Now().Add(time.Hour * 12).Unix(),
-	})
-
-	tokenString, err := token.SignedString(TokenSecret)
-
-	if err != nil {
-		return "", err
-	}
-	return tokenString, nil
+func (handler *UserHandler) createJWT(user *user.User, sess *session.Session, now time.Time) (string, error) {
+	return handler.Tokens.Create(user.Name, user.ID, sess.Handle, now)
 }
 
 type LoginError struct {
@@ -134,7 +133,7 @@ func (handler *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	now := time.Now().Unix()
+	now := time.Now()
 
 	lf, err := handler.parseLoginForm(r)
 
@@ -151,7 +150,18 @@ func (handler *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentUser := user.User{Name: lf.Name, Password: lf.Password, ID: userID}
+	currentUser := user.User{Name: lf.Name, Password: lf.Password, ID: userID, Role: user.RoleUser,
+		Created: now.UTC().Format(time.RFC3339Nano)}
+	if handler.Admins[currentUser.Name] {
+		currentUser.Role = user.RoleAdmin
+	}
+
+	// the name of the rules engine is taken, so nobody can pass for it
+	if strings.EqualFold(currentUser.Name, automod.Name) {
+		handler.sendRegisterError(w, currentUser.Name)
+		handler.Logger.Error(user.ErrUserAlready)
+		return
+	}
 
 	err = handler.Repo.AddUser(&currentUser)
 	if err != nil {
@@ -160,20 +170,33 @@ func (handler *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := handler.createJWT(&currentUser, now)
+	sess, err := handler.Sessions.CreateSession(w, r, currentUser.Name, currentUser.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		handler.Logger.Error(err)
 		return
 	}
-	resp, err := json.Marshal(map[string]string{"token": token})
+
+	token, err := handler.createJWT(&currentUser, sess, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	refreshToken, err := handler.Sessions.IssueRefreshToken(sess)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	resp, err := json.Marshal(map[string]string{"token": token, "refresh_token": refreshToken})
 	if err != nil {
 		http.Error(w, ErrJSONMarshal.Error(), http.StatusInternalServerError)
 		handler.Logger.Error(err)
 		return
 	}
 
-	handler.Sessions.CreateSession(w, currentUser.Name, currentUser.ID)
 	w.Header().Set("Content-Type", "application/json charset=utf-8")
 	w.WriteHeader(http.StatusCreated)
 
@@ -201,7 +224,7 @@ func (handler *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	now := time.Now().Unix()
+	now := time.Now()
 
 	lf, err := handler.parseLoginForm(r)
 	if err != nil {
@@ -210,7 +233,8 @@ func (handler *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch handler.Repo.CheckUser(lf.Name, lf.Password) {
+	switch err = handler.Repo.CheckUser(lf.Name, lf.Password); err {
+	case nil:
 	case user.ErrInvalidPassword:
 		handler.sendLoginError(w, user.ErrInvalidPassword.Error())
 		handler.Logger.Error(user.ErrInvalidPassword)
@@ -219,6 +243,10 @@ func (handler *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		handler.sendLoginError(w, user.ErrUserNotExist.Error())
 		handler.Logger.Error(user.ErrUserNotExist)
 		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
 	}
 
 	currentUser, err := handler.Repo.GetUser(lf.Name)
@@ -228,22 +256,48 @@ func (handler *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := handler.createJWT(currentUser, now)
+	err = handler.Policy.CheckSuspension(currentUser.ID)
+	if errors.Is(err, moderation.ErrSuspended) {
+		handler.sendJSON(w, http.StatusForbidden, map[string]string{"message": err.Error()})
+		handler.Logger.Infow("suspended user login",
+			"ID", currentUser.ID,
+			"Name", currentUser.Name)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	sess, err := handler.Sessions.CreateSession(w, r, currentUser.Name, currentUser.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		handler.Logger.Error(err)
 		return
 	}
 
-	resp, err := json.Marshal(map[string]string{"token": token})
+	token, err := handler.createJWT(currentUser, sess, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	refreshToken, err := handler.Sessions.IssueRefreshToken(sess)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	resp, err := json.Marshal(map[string]string{"token": token, "refresh_token": refreshToken})
 	if err != nil {
 		http.Error(w, ErrJSONMarshal.Error(), http.StatusInternalServerError)
 		handler.Logger.Error(ErrJSONMarshal)
 		return
 	}
 
-	handler.Sessions.CreateSession(w, currentUser.Name, currentUser.ID)
-
 	w.Header().Set("Content-Type", "application/json charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 
@@ -257,3 +311,117 @@ func (handler *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		"ID", currentUser.ID,
 		"Name", currentUser.Name)
 }
+
+type RefreshForm struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (handler *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("/token/refresh")
+	js, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, ErrReadReqBody.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	defer r.Body.Close()
+
+	rf := &RefreshForm{}
+	err = json.Unmarshal(js, rf)
+	if err != nil {
+		http.Error(w, ErrJSONUnmarshal.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	sess, refreshToken, err := handler.Sessions.RotateRefreshToken(rf.RefreshToken)
+	switch {
+	case errors.Is(err, session.ErrRefreshTokenReused):
+		handler.sendLoginError(w, err.Error())
+		handler.Logger.Warnw("refresh token reuse, session revoked",
+			"remote", r.RemoteAddr)
+		return
+	case errors.Is(err, session.ErrInvalidRefreshToken):
+		handler.sendLoginError(w, err.Error())
+		handler.Logger.Error(err)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	token, err := handler.Tokens.Create(sess.UserName, sess.UserID, sess.Handle, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	handler.sendJSON(w, http.StatusOK, map[string]string{"token": token, "refresh_token": refreshToken})
+	handler.Logger.Infow("token refreshed",
+		"ID", sess.UserID,
+		"session", sess.Handle)
+}
+
+type RoleForm struct {
+	Role string `json:"role"`
+}
+
+type RoleResponse struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// SetRole changes the site wide role of a user; only admins may do it.
+func (handler *UserHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("set role")
+	u, err := actor(r, handler.Repo)
+	if err != nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusUnauthorized)
+		handler.Logger.Error(err)
+		return
+	}
+	if err = handler.Policy.CanSetRole(u); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	target, err := handler.Repo.GetUser(strings.Split(r.URL.Path, "/")[3])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+
+	js, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, ErrReadReqBody.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	rf := &RoleForm{}
+	if err = json.Unmarshal(js, rf); err != nil {
+		http.Error(w, ErrJSONUnmarshal.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+
+	err = handler.Repo.SetRole(target.ID, rf.Role)
+	if errors.Is(err, user.ErrUnknownRole) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	handler.sendJSON(w, http.StatusOK, RoleResponse{Username: target.Name, Role: rf.Role})
+	handler.Logger.Infow("role changed",
+		"user", target.Name, "role", rf.Role, "by", u.Name)
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"redditclone/pkg/community"
+	"redditclone/pkg/webhooks"
+	"strings"
+	"time"
+)
+
+type WebhookForm struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// WebhookResponse is the only time the secret of a webhook is shown.
+type WebhookResponse struct {
+	*webhooks.Webhook
+	Secret string `json:"secret"`
+}
+
+func readWebhookForm(r *http.Request) (*WebhookForm, error) {
+	js, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		return nil, ErrReadReqBody
+	}
+	wf := &WebhookForm{}
+	if err = json.Unmarshal(js, wf); err != nil {
+		return nil, ErrJSONUnmarshal
+	}
+	wf.URL = strings.TrimSpace(wf.URL)
+	if err = webhooks.CheckURL(wf.URL); err != nil {
+		return nil, err
+	}
+	for _, e := range wf.Events {
+		if !webhooks.IsEvent(e) {
+			return nil, webhooks.ErrUnknownEvent
+		}
+	}
+	if wf.Events == nil {
+		wf.Events = make([]string, 0)
+	}
+	return wf, nil
+}
+
+// webhookInPath loads the webhook named in the path of a managed community.
+func (handler *CommunityHandler) webhookInPath(w http.ResponseWriter, r *http.Request) (*webhooks.Webhook, bool) {
+	c, ok := handler.managedCommunity(w, r)
+	if !ok {
+		return nil, false
+	}
+	hook, err := handler.Webhooks.GetWebhook(c.Name, strings.Split(r.URL.Path, "/")[5])
+	if errors.Is(err, webhooks.ErrWebhookNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return nil, false
+	}
+	return hook, true
+}
+
+// GetWebhooks lists the webhooks of the community without their secrets.
+func (handler *CommunityHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get webhooks")
+	c, ok := handler.managedCommunity(w, r)
+	if !ok {
+		return
+	}
+
+	hooks, err := handler.Webhooks.GetWebhooks(c.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendJSON(w, http.StatusOK, hooks)
+}
+
+// AddWebhook registers a URL for the events of the community and returns
+// the secret the deliveries are signed with.
+func (handler *CommunityHandler) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("add webhook")
+	u, c, ok := handler.actorAndCommunity(w, r)
+	if !ok {
+		return
+	}
+	if err := handler.Policy.CanManageCommunity(u, c); err != nil {
+		sendPolicyError(w, handler.Logger, err)
+		return
+	}
+
+	wf, err := readWebhookForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		handler.Logger.Error(err)
+		return
+	}
+	id, err := GenerateHexID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	hook := &webhooks.Webhook{
+		ID:        id,
+		Community: c.Name,
+		URL:       wf.URL,
+		Events:    wf.Events,
+		Secret:    secret,
+		Owner:     community.Member{Username: u.Name, ID: u.ID},
+		Created:   time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if err = handler.Webhooks.AddWebhook(hook); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	handler.sendJSON(w, http.StatusCreated, WebhookResponse{Webhook: hook, Secret: secret})
+	handler.Logger.Infow("webhook added",
+		"community", c.Name, "webhook", id, "by", u.Name)
+}
+
+// DeleteWebhook stops the deliveries of a webhook and drops its history.
+func (handler *CommunityHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("delete webhook")
+	hook, ok := handler.webhookInPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := handler.Webhooks.DeleteWebhook(hook.Community, hook.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendJSON(w, http.StatusOK, DeletePostResponse{Message: "success"})
+}
+
+// EnableWebhook resumes the deliveries of a webhook the dispatcher
+// disabled after too many dead ones. Its dead letters stay dead until they
+// are redelivered.
+func (handler *CommunityHandler) EnableWebhook(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("enable webhook")
+	hook, ok := handler.webhookInPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := handler.Webhooks.EnableWebhook(hook.Community, hook.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	hook.Disabled, hook.DeadInARow = false, 0
+	handler.sendJSON(w, http.StatusOK, hook)
+}
+
+// GetDeliveries shows the delivery history of a webhook, newest first;
+// ?status=dead lists the dead letters.
+func (handler *CommunityHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("get webhook deliveries")
+	hook, ok := handler.webhookInPath(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := handler.Webhooks.GetDeliveries(hook.ID, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendJSON(w, http.StatusOK, deliveries)
+}
+
+// Redeliver sends a past delivery again, typically a dead one after the
+// receiver is fixed.
+func (handler *CommunityHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	handler.Logger.Info("redeliver webhook delivery")
+	hook, ok := handler.webhookInPath(w, r)
+	if !ok {
+		return
+	}
+
+	del, err := handler.Webhooks.GetDelivery(hook.ID, strings.Split(r.URL.Path, "/")[7])
+	if errors.Is(err, webhooks.ErrDeliveryNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+
+	err = handler.Dispatcher.Redeliver(del)
+	if errors.Is(err, webhooks.ErrDeliveryPending) || errors.Is(err, webhooks.ErrWebhookDisabled) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		handler.Logger.Error(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		handler.Logger.Error(err)
+		return
+	}
+	handler.sendJSON(w, http.StatusAccepted, del)
+}
@@ -0,0 +1,58 @@
+package live
+
+import (
+	"encoding/json"
+	"redditclone/pkg/events"
+)
+
+type scoreData struct {
+	Score            int `json:"score"`
+	UpvotePercentage int `json:"upvotePercentage,omitempty"`
+}
+
+// Attach feeds the hub from the domain events of the bus. The streams
+// never hold up the writers: when the hub falls behind, events are dropped.
+func (hub *Hub) Attach(bus *events.Bus) *events.Subscription {
+	return bus.Subscribe("live", hub.publishDomainEvent, events.Options{
+		Names: []string{events.NamePostCreated, events.NamePostEdited, events.NamePostDeleted,
+			events.NameCommentAdded, events.NameCommentDeleted, events.NameVoteCast},
+		Delivery: events.Async,
+		Buffer:   SubscriptionBuffer,
+		Overflow: events.Drop,
+	})
+}
+
+func (hub *Hub) publishDomainEvent(de events.Event) {
+	var e Event
+	var data any
+	switch de := de.(type) {
+	case events.PostCreated:
+		e, data = Event{Type: EventPostCreated, PostID: de.Post.ID, Category: de.Post.Category}, de.Post
+	case events.PostEdited:
+		e, data = Event{Type: EventPostEdited, PostID: de.Post.ID, Category: de.Post.Category}, de.Post
+	case events.PostDeleted:
+		e = Event{Type: EventPostDeleted, PostID: de.PostID, Category: de.Category}
+	case events.CommentAdded:
+		e = Event{Type: EventCommentAdded, PostID: de.PostID, CommentID: de.Comment.ID, Category: de.Category}
+		data = de.Comment
+	case events.CommentDeleted:
+		e = Event{Type: EventCommentDeleted, PostID: de.PostID, CommentID: de.CommentID, Category: de.Category}
+	case events.VoteCast:
+		e = Event{Type: EventPostScore, PostID: de.PostID, Category: de.Category}
+		if de.CommentID != "" {
+			e.Type, e.CommentID = EventCommentScore, de.CommentID
+		}
+		data = scoreData{Score: de.Score, UpvotePercentage: de.UpvotePercentage}
+	default:
+		return
+	}
+
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return
+		}
+		e.Data = raw
+	}
+	hub.Publish(e)
+}
@@ -0,0 +1,110 @@
+package live
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+const (
+	EventPostCreated    = "post_created"
+	EventPostEdited     = "post_edited"
+	EventPostDeleted    = "post_deleted"
+	EventPostScore      = "post_score"
+	EventCommentAdded   = "comment_added"
+	EventCommentDeleted = "comment_deleted"
+	EventCommentScore   = "comment_score"
+)
+
+// SubscriptionBuffer is how many events a subscriber may fall behind before
+// new events are dropped for it.
+const SubscriptionBuffer = 64
+
+// Event is a change of a post. Data is the JSON of the change, taken when
+// the event is published: the post for new and edited posts, the comment
+// for new comments and the score for votes.
+type Event struct {
+	ID        uint64          `json:"-"`
+	Type      string          `json:"type"`
+	PostID    string          `json:"postId"`
+	CommentID string          `json:"commentId,omitempty"`
+	Category  string          `json:"category"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// Filter selects the events of one post, one category or, when empty, all
+// of them. Whether the subscriber may see an event is up to the reader of
+// the subscription, since membership can change while it is open.
+type Filter struct {
+	PostID   string
+	Category string
+}
+
+func (f Filter) matches(e *Event) bool {
+	if f.PostID != "" && e.PostID != f.PostID {
+		return false
+	}
+	if f.Category != "" && e.Category != f.Category {
+		return false
+	}
+	return true
+}
+
+// Hub passes events from the repository to the open streams of this
+// process.
+type Hub struct {
+	subs map[*Subscription]bool
+	seq  uint64
+	mu   sync.Mutex
+}
+
+type Subscription struct {
+	Events  chan Event
+	filter  Filter
+	dropped int
+	hub     *Hub
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]bool)}
+}
+
+func (hub *Hub) Subscribe(f Filter) *Subscription {
+	sub := &Subscription{Events: make(chan Event, SubscriptionBuffer), filter: f, hub: hub}
+	hub.mu.Lock()
+	hub.subs[sub] = true
+	hub.mu.Unlock()
+	return sub
+}
+
+// Publish numbers the event and hands it to the matching subscribers. It
+// never waits: a subscriber whose buffer is full misses the event.
+func (hub *Hub) Publish(e Event) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.seq++
+	e.ID = hub.seq
+	for sub := range hub.subs {
+		if !sub.filter.matches(&e) {
+			continue
+		}
+		select {
+		case sub.Events <- e:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Dropped tells how many events the subscriber missed so far.
+func (sub *Subscription) Dropped() int {
+	sub.hub.mu.Lock()
+	defer sub.hub.mu.Unlock()
+	return sub.dropped
+}
+
+func (sub *Subscription) Close() {
+	sub.hub.mu.Lock()
+	delete(sub.hub.subs, sub)
+	sub.hub.mu.Unlock()
+}
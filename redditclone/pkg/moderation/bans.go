@@ -0,0 +1,77 @@
+package moderation
+
+import (
+	"errors"
+	"fmt"
+	"redditclone/pkg/community"
+	"time"
+)
+
+const (
+	ActionBanUser   = "ban_user"
+	ActionUnbanUser = "unban_user"
+)
+
+var ErrNotBanned = errors.New("user is not banned")
+var ErrSuspended = errors.New("account suspended")
+var ErrBanned = errors.New("banned from this community")
+var ErrBadDuration = errors.New("duration must be a positive Go duration such as 72h")
+
+// Ban keeps a user out of one community, or out of the whole site when
+// Community is empty, which is a suspension. Expires is empty for permanent
+// bans.
+type Ban struct {
+	Community string           `json:"community,omitempty"`
+	User      community.Member `json:"user"`
+	Moderator community.Member `json:"moderator"`
+	Reason    string           `json:"reason"`
+	Expires   string           `json:"expires,omitempty"`
+	Created   string           `json:"created"`
+}
+
+type BanRepo interface {
+	// AddBan bans the user, replacing an earlier ban from the same place.
+	AddBan(b *Ban) error
+	DeleteBan(community, userID string) error
+	// GetBan returns the ban in force, ErrNotBanned when it is over.
+	GetBan(community, userID string) (*Ban, error)
+	// GetBans lists the bans in force, newest first; the empty community
+	// lists suspensions.
+	GetBans(community string) ([]*Ban, error)
+}
+
+func (b *Ban) Active(now time.Time) bool {
+	if b.Expires == "" {
+		return true
+	}
+	expires, err := time.Parse(time.RFC3339Nano, b.Expires)
+	if err != nil {
+		return true
+	}
+	return now.Before(expires)
+}
+
+// Err explains what the ban forbids, with its reason and end.
+func (b *Ban) Err() error {
+	base := ErrBanned
+	if b.Community == "" {
+		base = ErrSuspended
+	}
+	if b.Expires == "" {
+		return fmt.Errorf("%w: %s", base, b.Reason)
+	}
+	return fmt.Errorf("%w until %s: %s", base, b.Expires, b.Reason)
+}
+
+// ParseDuration reads the length of a ban; the empty string is a permanent
+// ban and gives a zero duration.
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, ErrBadDuration
+	}
+	return d, nil
+}
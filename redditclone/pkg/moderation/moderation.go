@@ -0,0 +1,31 @@
+package moderation
+
+import "redditclone/pkg/community"
+
+const (
+	ActionRemovePost    = "remove_post"
+	ActionRemoveComment = "remove_comment"
+	ActionLockPost      = "lock_post"
+	ActionUnlockPost    = "unlock_post"
+	ActionEditAutoMod   = "edit_automod"
+)
+
+// Action is an entry of the moderation log of a community. Details keeps
+// the title or the body of the removed content, which is gone afterwards.
+type Action struct {
+	ID        string           `json:"id"`
+	Community string           `json:"community"`
+	Moderator community.Member `json:"moderator"`
+	Action    string           `json:"action"`
+	PostID    string           `json:"postId,omitempty"`
+	CommentID string           `json:"commentId,omitempty"`
+	Author    string           `json:"author"`
+	Details   string           `json:"details,omitempty"`
+	Created   string           `json:"created"`
+}
+
+type ModLogRepo interface {
+	AddAction(a *Action) error
+	// GetActions returns the log of the community, newest first.
+	GetActions(community string) ([]*Action, error)
+}
@@ -0,0 +1,151 @@
+package moderation
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type ModLogMemoryRepository struct {
+	actions map[string][]*Action
+	mu      sync.RWMutex
+}
+
+func NewModLogMemoryRepository() *ModLogMemoryRepository {
+	return &ModLogMemoryRepository{actions: make(map[string][]*Action)}
+}
+
+func (repo *ModLogMemoryRepository) AddAction(a *Action) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.actions[a.Community] = append(repo.actions[a.Community], a)
+	return nil
+}
+
+func (repo *ModLogMemoryRepository) GetActions(community string) ([]*Action, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	log := repo.actions[community]
+	actions := make([]*Action, 0, len(log))
+	for i := len(log) - 1; i >= 0; i-- {
+		actions = append(actions, log[i])
+	}
+	return actions, nil
+}
+
+type ReportMemoryRepository struct {
+	reports []*Report
+	mu      sync.RWMutex
+}
+
+func NewReportMemoryRepository() *ReportMemoryRepository {
+	return &ReportMemoryRepository{reports: make([]*Report, 0)}
+}
+
+func (repo *ReportMemoryRepository) AddReport(r *Report) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, old := range repo.reports {
+		if old.Resolution == "" && old.PostID == r.PostID && old.CommentID == r.CommentID &&
+			old.Reporter.ID == r.Reporter.ID {
+			return ErrAlreadyReported
+		}
+	}
+	repo.reports = append(repo.reports, r)
+	return nil
+}
+
+func (repo *ReportMemoryRepository) GetQueue(community string) ([]*QueueItem, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	open := make([]*Report, 0)
+	for _, r := range repo.reports {
+		if r.Community == community && r.Resolution == "" {
+			open = append(open, r)
+		}
+	}
+	return aggregate(open), nil
+}
+
+func (repo *ReportMemoryRepository) ResolveReports(community, postID, commentID, decision string) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	n := 0
+	for _, r := range repo.reports {
+		if r.Community == community && r.PostID == postID && r.CommentID == commentID && r.Resolution == "" {
+			r.Resolution = decision
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, ErrReportNotFound
+	}
+	return n, nil
+}
+
+type banKey struct {
+	community string
+	userID    string
+}
+
+type BanMemoryRepository struct {
+	bans map[banKey]*Ban
+	mu   sync.RWMutex
+}
+
+func NewBanMemoryRepository() *BanMemoryRepository {
+	return &BanMemoryRepository{bans: make(map[banKey]*Ban)}
+}
+
+func (repo *BanMemoryRepository) AddBan(b *Ban) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.bans[banKey{b.Community, b.User.ID}] = b
+	return nil
+}
+
+func (repo *BanMemoryRepository) DeleteBan(community, userID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	key := banKey{community, userID}
+	b, ok := repo.bans[key]
+	if !ok || !b.Active(time.Now()) {
+		return ErrNotBanned
+	}
+	delete(repo.bans, key)
+	return nil
+}
+
+func (repo *BanMemoryRepository) GetBan(community, userID string) (*Ban, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	b, ok := repo.bans[banKey{community, userID}]
+	if !ok || !b.Active(time.Now()) {
+		return nil, ErrNotBanned
+	}
+	return b, nil
+}
+
+func (repo *BanMemoryRepository) GetBans(community string) ([]*Ban, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	now := time.Now()
+	bans := make([]*Ban, 0)
+	for key, b := range repo.bans {
+		if key.community == community && b.Active(now) {
+			bans = append(bans, b)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Created > bans[j].Created
+	})
+	return bans, nil
+}
@@ -0,0 +1,246 @@
+package moderation
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type ModLogSQLiteRepository struct {
+	db *sql.DB
+}
+
+var modLogSchema = []string{
+	`CREATE TABLE IF NOT EXISTS mod_actions (
+		id             TEXT PRIMARY KEY,
+		community      TEXT NOT NULL,
+		moderator_id   TEXT NOT NULL,
+		moderator_name TEXT NOT NULL,
+		action         TEXT NOT NULL,
+		post_id        TEXT NOT NULL,
+		comment_id     TEXT NOT NULL DEFAULT '',
+		author         TEXT NOT NULL DEFAULT '',
+		details        TEXT NOT NULL DEFAULT '',
+		created        TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS mod_actions_community_idx ON mod_actions (community)`,
+}
+
+const actionColumns = `id, community, moderator_id, moderator_name, action, post_id, comment_id, author, details, created`
+
+func NewModLogSQLiteRepository(db *sql.DB) (*ModLogSQLiteRepository, error) {
+	for _, stmt := range modLogSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &ModLogSQLiteRepository{db: db}, nil
+}
+
+func (repo *ModLogSQLiteRepository) AddAction(a *Action) error {
+	_, err := repo.db.Exec(`INSERT INTO mod_actions (`+actionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.Community, a.Moderator.ID, a.Moderator.Username, a.Action, a.PostID, a.CommentID, a.Author, a.Details, a.Created)
+	return err
+}
+
+func (repo *ModLogSQLiteRepository) GetActions(community string) ([]*Action, error) {
+	rows, err := repo.db.Query(`SELECT `+actionColumns+` FROM mod_actions WHERE community = ? ORDER BY rowid DESC`, community)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := make([]*Action, 0)
+	for rows.Next() {
+		a := &Action{}
+		err = rows.Scan(&a.ID, &a.Community, &a.Moderator.ID, &a.Moderator.Username, &a.Action,
+			&a.PostID, &a.CommentID, &a.Author, &a.Details, &a.Created)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
+
+type ReportSQLiteRepository struct {
+	db *sql.DB
+}
+
+var reportsSchema = []string{
+	`CREATE TABLE IF NOT EXISTS reports (
+		id            TEXT PRIMARY KEY,
+		community     TEXT NOT NULL,
+		post_id       TEXT NOT NULL,
+		comment_id    TEXT NOT NULL DEFAULT '',
+		reporter_id   TEXT NOT NULL,
+		reporter_name TEXT NOT NULL,
+		reason        TEXT NOT NULL,
+		details       TEXT NOT NULL DEFAULT '',
+		created       TEXT NOT NULL,
+		resolution    TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS reports_community_idx ON reports (community, resolution)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS reports_open_idx ON reports (post_id, comment_id, reporter_id)
+		WHERE resolution = ''`,
+}
+
+func NewReportSQLiteRepository(db *sql.DB) (*ReportSQLiteRepository, error) {
+	for _, stmt := range reportsSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &ReportSQLiteRepository{db: db}, nil
+}
+
+func (repo *ReportSQLiteRepository) AddReport(r *Report) error {
+	res, err := repo.db.Exec(`INSERT INTO reports (id, community, post_id, comment_id, reporter_id, reporter_name,
+		reason, details, created) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		r.ID, r.Community, r.PostID, r.CommentID, r.Reporter.ID, r.Reporter.Username, r.Reason, r.Details, r.Created)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAlreadyReported
+	}
+	return nil
+}
+
+func (repo *ReportSQLiteRepository) GetQueue(community string) ([]*QueueItem, error) {
+	rows, err := repo.db.Query(`SELECT id, community, post_id, comment_id, reporter_id, reporter_name,
+		reason, details, created FROM reports WHERE community = ? AND resolution = '' ORDER BY rowid`, community)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	open := make([]*Report, 0)
+	for rows.Next() {
+		r := &Report{}
+		err = rows.Scan(&r.ID, &r.Community, &r.PostID, &r.CommentID, &r.Reporter.ID, &r.Reporter.Username,
+			&r.Reason, &r.Details, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+		open = append(open, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return aggregate(open), nil
+}
+
+func (repo *ReportSQLiteRepository) ResolveReports(community, postID, commentID, decision string) (int, error) {
+	res, err := repo.db.Exec(`UPDATE reports SET resolution = ?
+		WHERE community = ? AND post_id = ? AND comment_id = ? AND resolution = ''`,
+		decision, community, postID, commentID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrReportNotFound
+	}
+	return int(n), nil
+}
+
+type BanSQLiteRepository struct {
+	db *sql.DB
+}
+
+var bansSchema = []string{
+	`CREATE TABLE IF NOT EXISTS bans (
+		community      TEXT NOT NULL,
+		user_id        TEXT NOT NULL,
+		username       TEXT NOT NULL,
+		moderator_id   TEXT NOT NULL,
+		moderator_name TEXT NOT NULL,
+		reason         TEXT NOT NULL,
+		expires        TEXT NOT NULL DEFAULT '',
+		created        TEXT NOT NULL,
+		PRIMARY KEY (community, user_id)
+	)`,
+}
+
+const banColumns = `community, user_id, username, moderator_id, moderator_name, reason, expires, created`
+
+func NewBanSQLiteRepository(db *sql.DB) (*BanSQLiteRepository, error) {
+	for _, stmt := range bansSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &BanSQLiteRepository{db: db}, nil
+}
+
+type banScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanBan(row banScanner) (*Ban, error) {
+	b := &Ban{}
+	err := row.Scan(&b.Community, &b.User.ID, &b.User.Username, &b.Moderator.ID, &b.Moderator.Username,
+		&b.Reason, &b.Expires, &b.Created)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (repo *BanSQLiteRepository) AddBan(b *Ban) error {
+	_, err := repo.db.Exec(`INSERT OR REPLACE INTO bans (`+banColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.Community, b.User.ID, b.User.Username, b.Moderator.ID, b.Moderator.Username, b.Reason, b.Expires, b.Created)
+	return err
+}
+
+func (repo *BanSQLiteRepository) DeleteBan(community, userID string) error {
+	if _, err := repo.GetBan(community, userID); err != nil {
+		return err
+	}
+	_, err := repo.db.Exec(`DELETE FROM bans WHERE community = ? AND user_id = ?`, community, userID)
+	return err
+}
+
+func (repo *BanSQLiteRepository) GetBan(community, userID string) (*Ban, error) {
+	b, err := scanBan(repo.db.QueryRow(`SELECT `+banColumns+` FROM bans WHERE community = ? AND user_id = ?`,
+		community, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotBanned
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !b.Active(time.Now()) {
+		return nil, ErrNotBanned
+	}
+	return b, nil
+}
+
+func (repo *BanSQLiteRepository) GetBans(community string) ([]*Ban, error) {
+	rows, err := repo.db.Query(`SELECT `+banColumns+` FROM bans WHERE community = ? ORDER BY created DESC`, community)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	bans := make([]*Ban, 0)
+	for rows.Next() {
+		b, err := scanBan(rows)
+		if err != nil {
+			return nil, err
+		}
+		if b.Active(now) {
+			bans = append(bans, b)
+		}
+	}
+	return bans, rows.Err()
+}
@@ -0,0 +1,116 @@
+package moderation
+
+import (
+	"errors"
+	"redditclone/pkg/community"
+	"sort"
+)
+
+const (
+	ActionApprovePost    = "approve_post"
+	ActionApproveComment = "approve_comment"
+	ActionDismissReports = "dismiss_reports"
+)
+
+// Decisions a moderator takes on a reported item.
+const (
+	DecisionApprove = "approve"
+	DecisionRemove  = "remove"
+	DecisionDismiss = "dismiss"
+)
+
+const MaxReasonLength = 500
+
+var ErrAlreadyReported = errors.New("already reported")
+var ErrReportNotFound = errors.New("no open reports for this item")
+var ErrBadReason = errors.New("report reason is required")
+var ErrUnknownDecision = errors.New("decision must be approve, remove or dismiss")
+
+// Report flags a post, or a comment when CommentID is set. Details keeps
+// the title or body of the content at the time of the report. Resolution is
+// the decision that closed the report, empty while it is open.
+type Report struct {
+	ID         string
+	Community  string
+	PostID     string
+	CommentID  string
+	Reporter   community.Member
+	Reason     string
+	Details    string
+	Created    string
+	Resolution string
+}
+
+type ReasonCount struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// QueueItem is a reported post or comment with its open reports.
+type QueueItem struct {
+	Community     string         `json:"community"`
+	PostID        string         `json:"postId"`
+	CommentID     string         `json:"commentId,omitempty"`
+	Details       string         `json:"details"`
+	Reports       int            `json:"reports"`
+	Reasons       []*ReasonCount `json:"reasons"`
+	FirstReported string         `json:"firstReported"`
+	LastReported  string         `json:"lastReported"`
+}
+
+type ReportRepo interface {
+	AddReport(r *Report) error
+	// GetQueue aggregates the open reports of the community per item, most
+	// reported first.
+	GetQueue(community string) ([]*QueueItem, error)
+	// ResolveReports closes the open reports of an item with the decision
+	// and returns how many were closed.
+	ResolveReports(community, postID, commentID, decision string) (int, error)
+}
+
+func IsDecision(decision string) bool {
+	return decision == DecisionApprove || decision == DecisionRemove || decision == DecisionDismiss
+}
+
+// aggregate groups open reports, given oldest first, into queue items.
+func aggregate(reports []*Report) []*QueueItem {
+	type key struct{ postID, commentID string }
+	items := make(map[key]*QueueItem)
+	order := make([]*QueueItem, 0)
+
+	for _, r := range reports {
+		k := key{r.PostID, r.CommentID}
+		item, ok := items[k]
+		if !ok {
+			item = &QueueItem{
+				Community:     r.Community,
+				PostID:        r.PostID,
+				CommentID:     r.CommentID,
+				Reasons:       make([]*ReasonCount, 0),
+				FirstReported: r.Created,
+			}
+			items[k] = item
+			order = append(order, item)
+		}
+		item.Reports++
+		item.Details = r.Details
+		item.LastReported = r.Created
+
+		found := false
+		for _, rc := range item.Reasons {
+			if rc.Reason == r.Reason {
+				rc.Count++
+				found = true
+				break
+			}
+		}
+		if !found {
+			item.Reasons = append(item.Reasons, &ReasonCount{Reason: r.Reason, Count: 1})
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].Reports > order[j].Reports
+	})
+	return order
+}
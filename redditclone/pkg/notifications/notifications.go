@@ -0,0 +1,104 @@
+package notifications
+
+import (
+	"errors"
+	post "redditclone/pkg/posts"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kinds of notifications.
+const (
+	KindPostReply    = "post_reply"
+	KindCommentReply = "comment_reply"
+	KindMention      = "mention"
+	KindModAction    = "mod_action"
+	KindUpvotes      = "upvotes"
+)
+
+// MaxPerUser is how many notifications are kept per user; older ones are
+// dropped.
+const MaxPerUser = 500
+
+// ExcerptLength is how much of a comment or post text a notification
+// quotes.
+const ExcerptLength = 200
+
+// Milestones are the scores of a post or comment its author hears about.
+var Milestones = []int{10, 50, 100, 500, 1000, 5000, 10000}
+
+var (
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrDuplicate            = errors.New("notification already sent")
+)
+
+// mentionPattern finds u/name, /u/name and @name; an @ inside a word, as in
+// an e-mail address, is not a mention.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@/])/?(?:u/|@)([\w-]+)`)
+
+// Notification tells a user about something that concerns them. Actor is
+// who did it, missing for score milestones. Key, when set, makes the
+// notification unique for its user.
+type Notification struct {
+	ID        string       `json:"id"`
+	UserID    string       `json:"-"`
+	Kind      string       `json:"kind"`
+	Actor     *post.Author `json:"actor,omitempty"`
+	Community string       `json:"community,omitempty"`
+	PostID    string       `json:"postId,omitempty"`
+	CommentID string       `json:"commentId,omitempty"`
+	Title     string       `json:"title,omitempty"`
+	Body      string       `json:"body,omitempty"`
+	Action    string       `json:"action,omitempty"`
+	Score     int          `json:"score,omitempty"`
+	Read      bool         `json:"read"`
+	Created   string       `json:"created"`
+	Key       string       `json:"-"`
+}
+
+// Repo is the inbox of each user, newest first.
+type Repo interface {
+	// AddNotification returns ErrDuplicate when the user already has a
+	// notification with the same key.
+	AddNotification(n *Notification) error
+	GetNotifications(userID string, unreadOnly bool) ([]*Notification, error)
+	MarkRead(userID, id string) error
+	// MarkAllRead returns how many notifications it marked.
+	MarkAllRead(userID string) (int, error)
+	UnreadCount(userID string) (int, error)
+}
+
+// Mentions returns the distinct user names mentioned in the texts.
+func Mentions(texts ...string) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, text := range texts {
+		for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				names = append(names, m[1])
+			}
+		}
+	}
+	return names
+}
+
+// IsMilestone reports whether a score is worth telling the author about.
+func IsMilestone(score int) bool {
+	for _, m := range Milestones {
+		if m == score {
+			return true
+		}
+	}
+	return false
+}
+
+func excerpt(text string) string {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) <= ExcerptLength {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:ExcerptLength]) + "…"
+}
@@ -0,0 +1,205 @@
+package notifications
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"redditclone/pkg/community"
+	"redditclone/pkg/events"
+	"redditclone/pkg/moderation"
+	post "redditclone/pkg/posts"
+	"redditclone/pkg/user"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// notifiedActions are the moderator actions the author of the content or
+// the banned user hears about.
+var notifiedActions = map[string]bool{
+	moderation.ActionRemovePost:    true,
+	moderation.ActionRemoveComment: true,
+	moderation.ActionLockPost:      true,
+	moderation.ActionUnlockPost:    true,
+	moderation.ActionBanUser:       true,
+	moderation.ActionUnbanUser:     true,
+}
+
+// Notifier fills the inboxes from the domain events: replies to posts and
+// comments, mentions, score milestones and moderator actions.
+type Notifier struct {
+	Repo        Repo
+	Users       user.UserRepo
+	Communities community.CommunityRepo
+	Logger      *zap.SugaredLogger
+}
+
+func NewNotifier(repo Repo, users user.UserRepo, communities community.CommunityRepo, logger *zap.SugaredLogger) *Notifier {
+	return &Notifier{Repo: repo, Users: users, Communities: communities, Logger: logger}
+}
+
+// Attach subscribes the notifier to the bus. Notifications may come a
+// moment after the change, but the writers only wait when the notifier is
+// far behind.
+func (n *Notifier) Attach(bus *events.Bus) *events.Subscription {
+	return bus.Subscribe("notifications", n.handleEvent, events.Options{
+		Names: []string{events.NamePostCreated, events.NameCommentAdded, events.NameVoteCast,
+			events.NameModActionRecorded},
+		Delivery:     events.Async,
+		Overflow:     events.Block,
+		BlockTimeout: time.Second,
+	})
+}
+
+func (n *Notifier) handleEvent(e events.Event) {
+	switch e := e.(type) {
+	case events.PostCreated:
+		p := e.Post
+		n.notifyMentions(&Notification{Community: p.Category, PostID: p.ID, Title: p.Title, Body: excerpt(p.Text)},
+			p.Author, nil, p.Title, p.Text)
+	case events.CommentAdded:
+		n.commentAdded(e)
+	case events.VoteCast:
+		n.voteCast(e)
+	case events.ModActionRecorded:
+		n.notifyModAction(&e.Action)
+	}
+}
+
+// commentAdded tells the author of the parent comment, or of the post for
+// top level comments, and the users mentioned in the comment. Authors
+// without an account, like the AutoModerator, are skipped.
+func (n *Notifier) commentAdded(e events.CommentAdded) {
+	comm := e.Comment
+	author := comm.UserAuthor
+	notified := map[string]bool{author.ID: true}
+
+	base := Notification{Community: e.Category, PostID: e.PostID, CommentID: comm.ID, Title: e.PostTitle,
+		Body: excerpt(comm.Body)}
+	recipient, kind := e.PostAuthor, KindPostReply
+	if comm.ParentID != "" {
+		recipient, kind = e.ParentAuthor, KindCommentReply
+	}
+	if recipient.ID != "" && !notified[recipient.ID] && n.hasAccount(recipient.ID) {
+		notified[recipient.ID] = true
+		reply := base
+		reply.UserID, reply.Kind, reply.Actor = recipient.ID, kind, &author
+		n.add(&reply)
+	}
+
+	n.notifyMentions(&base, author, notified, comm.Body)
+}
+
+// notifyMentions sends a copy of base to each mentioned user who can see
+// the community and was not notified yet.
+func (n *Notifier) notifyMentions(base *Notification, author post.Author, notified map[string]bool, texts ...string) {
+	names := Mentions(texts...)
+	if len(names) == 0 {
+		return
+	}
+	c, err := n.Communities.GetCommunity(base.Community)
+	if err != nil {
+		n.Logger.Error(err)
+		return
+	}
+	if notified == nil {
+		notified = map[string]bool{author.ID: true}
+	}
+
+	for _, name := range names {
+		u, err := n.Users.GetUser(name)
+		if errors.Is(err, user.ErrUserNotExist) {
+			continue
+		}
+		if err != nil {
+			n.Logger.Error(err)
+			continue
+		}
+		if notified[u.ID] || !c.CanView(u.ID) {
+			continue
+		}
+		notified[u.ID] = true
+
+		mention := *base
+		mention.UserID, mention.Kind, mention.Actor = u.ID, KindMention, &author
+		n.add(&mention)
+	}
+}
+
+// voteCast tells the author when an upvote brings the score to a
+// milestone, once per milestone.
+func (n *Notifier) voteCast(e events.VoteCast) {
+	if e.Vote <= 0 || !IsMilestone(e.Score) || e.Author.ID == e.UserID {
+		return
+	}
+	if !n.hasAccount(e.Author.ID) {
+		return
+	}
+	n.add(&Notification{
+		UserID:    e.Author.ID,
+		Kind:      KindUpvotes,
+		Community: e.Category,
+		PostID:    e.PostID,
+		CommentID: e.CommentID,
+		Score:     e.Score,
+		Key:       KindUpvotes + ":" + e.PostID + ":" + e.CommentID + ":" + strconv.Itoa(e.Score),
+	})
+}
+
+// hasAccount tells whether a user can be notified: AutoModerator replies
+// have no account behind them.
+func (n *Notifier) hasAccount(userID string) bool {
+	_, err := n.Users.GetUserByID(userID)
+	if err != nil && !errors.Is(err, user.ErrUserNotExist) {
+		n.Logger.Error(err)
+	}
+	return err == nil
+}
+
+// notifyModAction tells the user an action was about, unless the
+// moderator acted on their own content.
+func (n *Notifier) notifyModAction(a *moderation.Action) {
+	if !notifiedActions[a.Action] || a.Author == "" || a.Author == a.Moderator.Username {
+		return
+	}
+	u, err := n.Users.GetUser(a.Author)
+	if err != nil {
+		if !errors.Is(err, user.ErrUserNotExist) {
+			n.Logger.Error(err)
+		}
+		return
+	}
+	n.add(&Notification{
+		UserID:    u.ID,
+		Kind:      KindModAction,
+		Actor:     &post.Author{Username: a.Moderator.Username, ID: a.Moderator.ID},
+		Community: a.Community,
+		PostID:    a.PostID,
+		CommentID: a.CommentID,
+		Body:      excerpt(a.Details),
+		Action:    a.Action,
+	})
+}
+
+func (n *Notifier) add(notification *Notification) {
+	id, err := newID()
+	if err != nil {
+		n.Logger.Error(err)
+		return
+	}
+	notification.ID = id
+	notification.Created = time.Now().UTC().Format(time.RFC3339Nano)
+	err = n.Repo.AddNotification(notification)
+	if err != nil && !errors.Is(err, ErrDuplicate) {
+		n.Logger.Error(err)
+	}
+}
+
+func newID() (string, error) {
+	bytes := make([]byte, 12)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,87 @@
+package notifications
+
+import (
+	"sync"
+)
+
+type MemoryRepository struct {
+	inbox map[string][]*Notification
+	mu    sync.RWMutex
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{inbox: make(map[string][]*Notification)}
+}
+
+func (repo *MemoryRepository) AddNotification(n *Notification) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	inbox := repo.inbox[n.UserID]
+	if n.Key != "" {
+		for _, old := range inbox {
+			if old.Key == n.Key {
+				return ErrDuplicate
+			}
+		}
+	}
+	stored := *n
+	inbox = append(inbox, &stored)
+	if len(inbox) > MaxPerUser {
+		inbox = inbox[len(inbox)-MaxPerUser:]
+	}
+	repo.inbox[n.UserID] = inbox
+	return nil
+}
+
+func (repo *MemoryRepository) GetNotifications(userID string, unreadOnly bool) ([]*Notification, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	inbox := repo.inbox[userID]
+	list := make([]*Notification, 0, len(inbox))
+	for i := len(inbox) - 1; i >= 0; i-- {
+		if !unreadOnly || !inbox[i].Read {
+			copied := *inbox[i]
+			list = append(list, &copied)
+		}
+	}
+	return list, nil
+}
+
+func (repo *MemoryRepository) MarkRead(userID, id string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, n := range repo.inbox[userID] {
+		if n.ID == id {
+			n.Read = true
+			return nil
+		}
+	}
+	return ErrNotificationNotFound
+}
+
+func (repo *MemoryRepository) MarkAllRead(userID string) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	marked := 0
+	for _, n := range repo.inbox[userID] {
+		if !n.Read {
+			n.Read = true
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (repo *MemoryRepository) UnreadCount(userID string) (int, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	unread := 0
+	for _, n := range repo.inbox[userID] {
+		if !n.Read {
+			unread++
+		}
+	}
+	return unread, nil
+}
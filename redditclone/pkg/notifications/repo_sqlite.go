@@ -0,0 +1,123 @@
+package notifications
+
+import (
+	"database/sql"
+	post "redditclone/pkg/posts"
+)
+
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS notifications (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL,
+		kind       TEXT NOT NULL,
+		actor_id   TEXT NOT NULL DEFAULT '',
+		actor_name TEXT NOT NULL DEFAULT '',
+		community  TEXT NOT NULL DEFAULT '',
+		post_id    TEXT NOT NULL DEFAULT '',
+		comment_id TEXT NOT NULL DEFAULT '',
+		title      TEXT NOT NULL DEFAULT '',
+		body       TEXT NOT NULL DEFAULT '',
+		action     TEXT NOT NULL DEFAULT '',
+		score      INTEGER NOT NULL DEFAULT 0,
+		read       INTEGER NOT NULL DEFAULT 0,
+		created    TEXT NOT NULL,
+		key        TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications (user_id, read)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS notifications_key_idx ON notifications (user_id, key) WHERE key != ''`,
+}
+
+const notificationColumns = `id, user_id, kind, actor_id, actor_name, community, post_id, comment_id, title, body,
+	action, score, read, created, key`
+
+func NewSQLiteRepository(db *sql.DB) (*SQLiteRepository, error) {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &SQLiteRepository{db: db}, nil
+}
+
+func (repo *SQLiteRepository) AddNotification(n *Notification) error {
+	var actor post.Author
+	if n.Actor != nil {
+		actor = *n.Actor
+	}
+	res, err := repo.db.Exec(`INSERT INTO notifications (`+notificationColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		n.ID, n.UserID, n.Kind, actor.ID, actor.Username, n.Community, n.PostID, n.CommentID, n.Title, n.Body,
+		n.Action, n.Score, n.Read, n.Created, n.Key)
+	if err != nil {
+		return err
+	}
+	if added, err := res.RowsAffected(); err != nil || added == 0 {
+		if err != nil {
+			return err
+		}
+		return ErrDuplicate
+	}
+
+	_, err = repo.db.Exec(`DELETE FROM notifications WHERE user_id = ? AND rowid NOT IN (
+		SELECT rowid FROM notifications WHERE user_id = ? ORDER BY rowid DESC LIMIT ?)`,
+		n.UserID, n.UserID, MaxPerUser)
+	return err
+}
+
+func (repo *SQLiteRepository) GetNotifications(userID string, unreadOnly bool) ([]*Notification, error) {
+	rows, err := repo.db.Query(`SELECT `+notificationColumns+` FROM notifications
+		WHERE user_id = ? AND (? = 0 OR read = 0) ORDER BY rowid DESC`, userID, unreadOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*Notification, 0)
+	for rows.Next() {
+		n := &Notification{}
+		actor := post.Author{}
+		err = rows.Scan(&n.ID, &n.UserID, &n.Kind, &actor.ID, &actor.Username, &n.Community, &n.PostID,
+			&n.CommentID, &n.Title, &n.Body, &n.Action, &n.Score, &n.Read, &n.Created, &n.Key)
+		if err != nil {
+			return nil, err
+		}
+		if actor.ID != "" {
+			n.Actor = &actor
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
+
+func (repo *SQLiteRepository) MarkRead(userID, id string) error {
+	res, err := repo.db.Exec(`UPDATE notifications SET read = 1 WHERE user_id = ? AND id = ?`, userID, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return err
+		}
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+func (repo *SQLiteRepository) MarkAllRead(userID string) (int, error) {
+	res, err := repo.db.Exec(`UPDATE notifications SET read = 1 WHERE user_id = ? AND read = 0`, userID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (repo *SQLiteRepository) UnreadCount(userID string) (int, error) {
+	var unread int
+	err := repo.db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read = 0`, userID).Scan(&unread)
+	return unread, err
+}
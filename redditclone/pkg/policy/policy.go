@@ -0,0 +1,139 @@
+package policy
+
+import (
+	"errors"
+	"redditclone/pkg/community"
+	"redditclone/pkg/moderation"
+	"redditclone/pkg/user"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+// Policy decides what a user may do. Site admins may do anything, the owner
+// and the moderators of a community moderate it, and everyone else may only
+// remove what they wrote. Suspended users may do nothing and users banned
+// from a community may not take part in it.
+type Policy struct {
+	Communities community.CommunityRepo
+	Bans        moderation.BanRepo
+}
+
+func (pol *Policy) IsModerator(u *user.User, name string) (bool, error) {
+	if u.IsAdmin() || u.IsModerator(name) {
+		return true, nil
+	}
+
+	c, err := pol.Communities.GetCommunity(name)
+	if errors.Is(err, community.ErrCommunityNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return c.Owner.ID == u.ID, nil
+}
+
+// CanRemove checks whether the user may remove content written by authorID
+// in the community, and whether that removal is a moderator action.
+func (pol *Policy) CanRemove(u *user.User, name, authorID string) (asModerator bool, err error) {
+	if u.ID == authorID {
+		return false, nil
+	}
+
+	ok, err := pol.IsModerator(u, name)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, ErrForbidden
+	}
+	return true, nil
+}
+
+// CanModerate lets moderators see the moderation tools of the community.
+func (pol *Policy) CanModerate(u *user.User, name string) error {
+	ok, err := pol.IsModerator(u, name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanManageCommunity covers members and moderators, which only the owner
+// and admins change.
+func (pol *Policy) CanManageCommunity(u *user.User, c *community.Community) error {
+	if u.IsAdmin() || c.Owner.ID == u.ID {
+		return nil
+	}
+	return ErrForbidden
+}
+
+func (pol *Policy) CanSetRole(u *user.User) error {
+	if u.IsAdmin() {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// CheckSuspension fails with ErrSuspended while the user is suspended.
+func (pol *Policy) CheckSuspension(userID string) error {
+	b, err := pol.Bans.GetBan("", userID)
+	if errors.Is(err, moderation.ErrNotBanned) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return b.Err()
+}
+
+// CanParticipate covers posting, commenting and voting in the community.
+func (pol *Policy) CanParticipate(userID, name string) error {
+	if err := pol.CheckSuspension(userID); err != nil {
+		return err
+	}
+
+	b, err := pol.Bans.GetBan(name, userID)
+	if errors.Is(err, moderation.ErrNotBanned) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return b.Err()
+}
+
+// CanBan lets moderators ban users from the community. Nobody can ban a
+// moderator of it, so a ban is never a way around the owner.
+func (pol *Policy) CanBan(u, target *user.User, name string) error {
+	if err := pol.CanModerate(u, name); err != nil {
+		return err
+	}
+	ok, err := pol.IsModerator(target, name)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanManageUsers covers the site wide lists of users, such as suspensions.
+func (pol *Policy) CanManageUsers(u *user.User) error {
+	if u.IsAdmin() {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// CanSuspend lets admins suspend anyone but other admins.
+func (pol *Policy) CanSuspend(u, target *user.User) error {
+	if u.IsAdmin() && !target.IsAdmin() {
+		return nil
+	}
+	return ErrForbidden
+}
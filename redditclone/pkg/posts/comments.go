@@ -0,0 +1,191 @@
+package post
+
+import "errors"
+
+var ErrCommentDeleted = errors.New("comment deleted")
+
+const DeletedCommentBody = "[deleted]"
+
+const (
+	DefaultCommentTreeDepth = 5
+	MaxCommentTreeDepth     = 10
+)
+
+// CommentNode is a comment with its replies. When the tree is cut at the
+// requested depth, More tells how many direct replies can be loaded by
+// asking for the subtree of this comment.
+type CommentNode struct {
+	*Comment
+	Replies []*CommentNode `json:"replies"`
+	More    int            `json:"more,omitempty"`
+}
+
+func findComment(comments []*Comment, commentID string) *Comment {
+	for _, comm := range comments {
+		if comm.ID == commentID {
+			return comm
+		}
+	}
+	return nil
+}
+
+func countReplies(comments []*Comment, commentID string, dropped map[string]bool) int {
+	count := 0
+	for _, comm := range comments {
+		if comm.ParentID == commentID && !dropped[comm.ID] {
+			count++
+		}
+	}
+	return count
+}
+
+// prepareReply checks the parent of a reply and sets the reply depth.
+func prepareReply(comments []*Comment, comment *Comment) error {
+	if comment.ParentID == "" {
+		comment.Depth = 0
+		return nil
+	}
+
+	parent := findComment(comments, comment.ParentID)
+	if parent == nil {
+		return ErrCommentNotFound
+	}
+	if parent.Deleted {
+		return ErrCommentDeleted
+	}
+	comment.Depth = parent.Depth + 1
+	return nil
+}
+
+// planCommentDeletion decides what deleting target does to the thread. A
+// comment with replies becomes a tombstone so the subtree survives; a leaf is
+// dropped together with tombstoned ancestors left without replies.
+func planCommentDeletion(comments []*Comment, target *Comment) (dropped map[string]bool, tombstone bool) {
+	dropped = make(map[string]bool)
+	if countReplies(comments, target.ID, dropped) > 0 {
+		return dropped, true
+	}
+
+	dropped[target.ID] = true
+	parent := findComment(comments, target.ParentID)
+	for parent != nil && parent.Deleted && countReplies(comments, parent.ID, dropped) == 0 {
+		dropped[parent.ID] = true
+		parent = findComment(comments, parent.ParentID)
+	}
+	return dropped, false
+}
+
+// GetComment returns a comment of the post that is not deleted.
+func (p *Post) GetComment(commentID string) (*Comment, error) {
+	comm := findComment(p.Comments, commentID)
+	if comm == nil || comm.Deleted {
+		return nil, ErrCommentNotFound
+	}
+	return comm, nil
+}
+
+// VisibleComments leaves out the comments held for review together with the
+// replies under them.
+func VisibleComments(comments []*Comment) []*Comment {
+	if comments == nil {
+		return nil
+	}
+	held := make(map[string]bool)
+	for _, comm := range comments {
+		if comm.Filtered {
+			held[comm.ID] = true
+		}
+	}
+	if len(held) == 0 {
+		return comments
+	}
+
+	visible := make([]*Comment, 0, len(comments))
+	for _, comm := range comments {
+		hidden := false
+		for parent := comm; parent != nil && !hidden; parent = findComment(comments, parent.ParentID) {
+			hidden = held[parent.ID]
+		}
+		if !hidden {
+			visible = append(visible, comm)
+		}
+	}
+	return visible
+}
+
+func tombstoneComment(comment *Comment) {
+	comment.Body = DeletedCommentBody
+	comment.UserAuthor = Author{Username: DeletedCommentBody}
+	comment.Deleted = true
+}
+
+// BuildCommentTree arranges the flat comment list of a post into a tree
+// rooted at rootID ("" for the whole post), at most maxDepth levels deep.
+func BuildCommentTree(comments []*Comment, rootID string, maxDepth int) ([]*CommentNode, error) {
+	if rootID != "" && findComment(comments, rootID) == nil {
+		return nil, ErrCommentNotFound
+	}
+
+	children := make(map[string][]*Comment)
+	for _, comm := range comments {
+		children[comm.ParentID] = append(children[comm.ParentID], comm)
+	}
+
+	var build func(parentID string, level int) []*CommentNode
+	build = func(parentID string, level int) []*CommentNode {
+		nodes := make([]*CommentNode, 0, len(children[parentID]))
+		for _, comm := range children[parentID] {
+			node := &CommentNode{Comment: comm, Replies: make([]*CommentNode, 0)}
+			if level+1 < maxDepth {
+				node.Replies = build(comm.ID, level+1)
+			} else {
+				node.More = len(children[comm.ID])
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+
+	return build(rootID, 0), nil
+}
+
+func votableComment(comments []*Comment, commentID string) (*Comment, error) {
+	comm := findComment(comments, commentID)
+	if comm == nil {
+		return nil, ErrCommentNotFound
+	}
+	if comm.Deleted {
+		return nil, ErrCommentDeleted
+	}
+	return comm, nil
+}
+
+func countCommentScore(comm *Comment) {
+	comm.Score = 0
+	for _, v := range comm.Votes {
+		comm.Score += v.Vote
+	}
+}
+
+func setCommentVote(comm *Comment, v *Vote) {
+	for _, vote := range comm.Votes {
+		if vote.UserID == v.UserID {
+			vote.Vote = v.Vote
+			countCommentScore(comm)
+			return
+		}
+	}
+	comm.Votes = append(comm.Votes, v)
+	countCommentScore(comm)
+}
+
+func removeCommentVote(comm *Comment, userID string) error {
+	for i, vote := range comm.Votes {
+		if vote.UserID == userID {
+			comm.Votes = append(comm.Votes[:i], comm.Votes[i+1:]...)
+			countCommentScore(comm)
+			return nil
+		}
+	}
+	return ErrAccessDenied
+}
@@ -0,0 +1,189 @@
+package post
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrBadCursor = errors.New("bad cursor")
+
+const (
+	DefaultListLimit = 25
+	MaxListLimit     = 100
+)
+
+// ListQuery describes one page of a listing. Category and Author filter the
+// posts, a non-nil Categories keeps only posts of the listed categories and
+// Exclude drops posts of the given ones; After and Before are cursors taken
+// from a previous Listing.
+type ListQuery struct {
+	Category   string
+	Categories []string
+	Author     string
+	Exclude    []string
+	Rank       RankOptions
+	After      string
+	Before     string
+	Limit      int
+}
+
+// Listing is a page of posts with cursors to the neighbouring pages; an
+// empty cursor means there is nothing more in that direction.
+type Listing struct {
+	Posts  []*Post
+	After  string
+	Before string
+}
+
+// cursor pins a position in a listing together with the moment the listing
+// was first requested, so time dependent ranks and windows stay the same
+// while the client scrolls.
+type cursor struct {
+	Sort   string     `json:"s"`
+	Window string     `json:"w,omitempty"`
+	Item   rankedItem `json:"p"`
+	Now    int64      `json:"n"`
+}
+
+func encodeCursor(c cursor) string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+	c := &cursor{}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, ErrBadCursor
+	}
+	return c, nil
+}
+
+// matches applies every filter of the query to a post; they all have to
+// hold.
+func (q ListQuery) matches(p *Post) bool {
+	switch {
+	case q.Category != "" && p.Category != q.Category:
+		return false
+	case q.Author != "" && p.Author.Username != q.Author:
+		return false
+	case q.Categories != nil && !containsString(q.Categories, p.Category):
+		return false
+	case p.Filtered:
+		return false
+	}
+	return !q.excluded(p.Category)
+}
+
+func (q ListQuery) excluded(category string) bool {
+	return containsString(q.Exclude, category)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// pageRequest is the part of a query that selects a page of ranked items.
+type pageRequest struct {
+	Sort   string
+	Window string
+	After  string
+	Before string
+	Limit  int
+}
+
+func (pr pageRequest) limit() int {
+	switch {
+	case pr.Limit <= 0:
+		return DefaultListLimit
+	case pr.Limit > MaxListLimit:
+		return MaxListLimit
+	default:
+		return pr.Limit
+	}
+}
+
+// start decodes the cursor of the request, if any, and returns the moment
+// the items are to be ranked at.
+func (pr pageRequest) start() (*cursor, time.Time, error) {
+	if pr.After == "" && pr.Before == "" {
+		return nil, time.Now(), nil
+	}
+	if pr.After != "" && pr.Before != "" {
+		return nil, time.Time{}, ErrBadCursor
+	}
+
+	pos, err := decodeCursor(pr.After + pr.Before)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if pos.Sort != pr.Sort || pos.Window != pr.Window {
+		return nil, time.Time{}, ErrBadCursor
+	}
+	return pos, time.Unix(0, pos.Now), nil
+}
+
+// cut returns the ids of the requested page of the ranked items and the
+// cursors around it.
+func (pr pageRequest) cut(items []rankedItem, pos *cursor, now time.Time) (ids []string, after, before string) {
+	start, end := 0, len(items)
+	switch {
+	case pr.After != "":
+		for start < len(items) && !pos.Item.before(items[start]) {
+			start++
+		}
+		end = min(start+pr.limit(), len(items))
+	case pr.Before != "":
+		for end > 0 && !items[end-1].before(pos.Item) {
+			end--
+		}
+		start = max(end-pr.limit(), 0)
+	default:
+		end = min(pr.limit(), len(items))
+	}
+
+	for _, item := range items[start:end] {
+		ids = append(ids, item.ID)
+	}
+	at := func(i int) string {
+		return encodeCursor(cursor{Sort: pr.Sort, Window: pr.Window, Item: items[i], Now: now.UnixNano()})
+	}
+	if end < len(items) && end > start {
+		after = at(end - 1)
+	}
+	if start > 0 && end > start {
+		before = at(start)
+	}
+	return ids, after, before
+}
+
+// page ranks the candidate posts and cuts out the requested page. It returns
+// the ids of the page in order and the cursors around it.
+func (q ListQuery) page(stats []RankStats) (ids []string, after, before string, err error) {
+	pr := pageRequest{Sort: q.Rank.Sort, Window: q.Rank.Window, After: q.After, Before: q.Before, Limit: q.Limit}
+	pos, now, err := pr.start()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	items, err := rank(stats, q.Rank, now)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	ids, after, before = pr.cut(items, pos, now)
+	return ids, after, before, nil
+}
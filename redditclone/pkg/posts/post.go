@@ -1,5 +1,9 @@
 package post
 
+import "encoding/json"
+
+// Post is a submission. Filtered posts and comments are held for the
+// moderators by the automoderator and stay out of listings until approved.
 type Post struct {
 	Score            int        `json:"score"`
 	Views            int        `json:"views"`
@@ -14,6 +18,42 @@ type Post struct {
 	ID               string     `json:"id"`
 	CreatedTime      string     `json:"created"`
 	URL              string     `json:"url,omitempty"`
+	Edited           string     `json:"edited,omitempty"`
+	Flair            string     `json:"flair,omitempty"`
+	Locked           bool       `json:"locked,omitempty"`
+	Filtered         bool       `json:"filtered,omitempty"`
+}
+
+// MarshalJSON leaves out the comments held for review, which the moderators
+// see in the mod queue instead.
+func (p Post) MarshalJSON() ([]byte, error) {
+	type plain Post
+	visible := plain(p)
+	visible.Comments = VisibleComments(p.Comments)
+	return json.Marshal(visible)
+}
+
+// copyPost copies the post down to its votes and comments, which the
+// repositories change in place.
+func copyPost(p *Post) Post {
+	c := *p
+	c.Votes = copyVotes(p.Votes)
+	c.Comments = make([]*Comment, 0, len(p.Comments))
+	for _, comm := range p.Comments {
+		copied := *comm
+		copied.Votes = copyVotes(comm.Votes)
+		c.Comments = append(c.Comments, &copied)
+	}
+	return c
+}
+
+func copyVotes(votes []*Vote) []*Vote {
+	copied := make([]*Vote, 0, len(votes))
+	for _, v := range votes {
+		vote := *v
+		copied = append(copied, &vote)
+	}
+	return copied
 }
 
 type Author struct {
@@ -27,10 +67,30 @@ type Vote struct {
 }
 
 type Comment struct {
-	Body        string `json:"body"`
-	UserAuthor  Author `json:"author"`
-	CreatedTime string `json:"created"`
-	ID          string `json:"id"`
+	Body        string  `json:"body"`
+	UserAuthor  Author  `json:"author"`
+	CreatedTime string  `json:"created"`
+	ID          string  `json:"id"`
+	ParentID    string  `json:"parentId,omitempty"`
+	Depth       int     `json:"depth"`
+	Deleted     bool    `json:"deleted,omitempty"`
+	Filtered    bool    `json:"filtered,omitempty"`
+	Score       int     `json:"score"`
+	Votes       []*Vote `json:"votes"`
+}
+
+type Revision struct {
+	Category string `json:"category"`
+	Text     string `json:"text,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Created  string `json:"created"`
+}
+
+// PostEdit holds the fields an author changes; nil fields are kept as is.
+type PostEdit struct {
+	Text     *string
+	URL      *string
+	Category *string
 }
 
 const (
@@ -44,12 +104,28 @@ type PostRepo interface {
 	AddViews(post *Post)
 	GetPostsWithCategory(category string) (map[string]*Post, error)
 	AddCommentToPost(postID string, comment *Comment) error
-	DeleteComment(post *Post, commentID string, userID string) error
+	DeleteComment(post *Post, commentID string) error
 	issueScoreAndPercentage(p *Post)
-	AddVote(p *Post, v *Vote, voteValue int)
+	AddVote(p *Post, v *Vote, voteValue int) error
 	DeleteVote(p *Post, userID string) error
-	DeletePost(p *Post, userName, userID string) error
+	DeletePost(p *Post) error
 	GetUserPosts(userName string) ([]*Post, error)
 	AddPost(p *Post) error
-	GetAllPosts() map[string]*Post
+	GetAllPosts() (map[string]*Post, error)
+	EditPost(p *Post, edit *PostEdit, userID, editedTime string) error
+	GetRevisions(postID string) ([]*Revision, error)
+	AddCommentVote(p *Post, commentID string, v *Vote) error
+	DeleteCommentVote(p *Post, commentID, userID string) error
+	ListPosts(q ListQuery) (*Listing, error)
+	SearchPosts(q SearchQuery) (*Listing, error)
+	SetFlair(p *Post, flair string) error
+	SetLocked(p *Post, locked bool) error
+	// SetFiltered holds the post, or its comment when commentID is set, for
+	// review or releases it.
+	SetFiltered(p *Post, commentID string, filtered bool) error
+	// Snapshot copies the post down to its votes and comments while no
+	// change to it is under way.
+	Snapshot(p *Post) Post
+	// GetKarma sums the scores of the posts and comments of the user.
+	GetKarma(userID string) (int, error)
 }
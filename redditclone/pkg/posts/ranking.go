@@ -0,0 +1,169 @@
+package post
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+var ErrUnknownTimeWindow = errors.New("unknown time window")
+
+const (
+	PostSortHot           = "hot"
+	PostSortTop           = "top"
+	PostSortNew           = "new"
+	PostSortRising        = "rising"
+	PostSortControversial = "controversial"
+)
+
+var timeWindows = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+// RankOptions selects the order of a listing. Window ("hour" ... "all")
+// limits top and controversial listings to recent posts.
+type RankOptions struct {
+	Sort   string
+	Window string
+}
+
+// RankStats is everything ranking needs to know about a post, so storages
+// can rank without loading whole posts.
+type RankStats struct {
+	ID       string
+	Score    int
+	Ups      int
+	Downs    int
+	Comments int
+	Created  time.Time
+}
+
+func StatsOf(p *Post) RankStats {
+	ups, downs := countVotes(p.Votes)
+	comments := 0
+	for _, comm := range VisibleComments(p.Comments) {
+		if !comm.Deleted {
+			comments++
+		}
+	}
+	return RankStats{
+		ID:       p.ID,
+		Score:    p.Score,
+		Ups:      ups,
+		Downs:    downs,
+		Comments: comments,
+		Created:  parseCreated(p.CreatedTime),
+	}
+}
+
+// hotEpoch is the reference point of the hot score; posts gain the weight of
+// ten times the votes every 12.5 hours after it.
+var hotEpoch = time.Unix(1134028003, 0)
+
+const risingPeriod = 24 * time.Hour
+
+func hotScore(s RankStats) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(s.Score)), 1))
+	sign := 0.0
+	if s.Score > 0 {
+		sign = 1
+	} else if s.Score < 0 {
+		sign = -1
+	}
+	return sign*order + s.Created.Sub(hotEpoch).Seconds()/45000
+}
+
+// risingScore is the activity per hour with gravity, so fresh posts that
+// quickly gather votes and comments come first.
+func risingScore(s RankStats, now time.Time) float64 {
+	hours := now.Sub(s.Created).Hours()
+	return float64(s.Score+s.Comments) / math.Pow(math.Max(hours, 0)+2, 1.5)
+}
+
+func (opts RankOptions) key(now time.Time) (func(s RankStats) float64, error) {
+	switch opts.Sort {
+	case "", PostSortHot:
+		return hotScore, nil
+	case PostSortTop:
+		return func(s RankStats) float64 { return float64(s.Score) }, nil
+	case PostSortNew:
+		return func(s RankStats) float64 { return 0 }, nil
+	case PostSortRising:
+		return func(s RankStats) float64 { return risingScore(s, now) }, nil
+	case PostSortControversial:
+		return func(s RankStats) float64 { return controversy(s.Ups, s.Downs) }, nil
+	default:
+		return nil, ErrUnknownSort
+	}
+}
+
+func (opts RankOptions) cutoff(now time.Time) (time.Time, error) {
+	switch opts.Sort {
+	case PostSortTop, PostSortControversial:
+		window := opts.Window
+		if window == "" {
+			window = "all"
+		}
+		d, ok := timeWindows[window]
+		if !ok {
+			return time.Time{}, ErrUnknownTimeWindow
+		}
+		if d == 0 {
+			return time.Time{}, nil
+		}
+		return now.Add(-d), nil
+	case PostSortRising:
+		return now.Add(-risingPeriod), nil
+	default:
+		return time.Time{}, nil
+	}
+}
+
+// rankedItem is a post position in a listing: the sort key, then the
+// creation time and the id as tie breakers, which makes the order total.
+type rankedItem struct {
+	Key     float64
+	Created int64
+	ID      string
+}
+
+// before reports whether a is listed before b.
+func (a rankedItem) before(b rankedItem) bool {
+	if a.Key != b.Key {
+		return a.Key > b.Key
+	}
+	if a.Created != b.Created {
+		return a.Created > b.Created
+	}
+	return a.ID > b.ID
+}
+
+func rank(stats []RankStats, opts RankOptions, now time.Time) ([]rankedItem, error) {
+	key, err := opts.key(now)
+	if err != nil {
+		return nil, err
+	}
+	cutoff, err := opts.cutoff(now)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]rankedItem, 0, len(stats))
+	for _, s := range stats {
+		if s.Created.Before(cutoff) {
+			continue
+		}
+		items = append(items, rankedItem{Key: key(s), Created: s.Created.UnixNano(), ID: s.ID})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].before(items[j])
+	})
+	return items, nil
+}
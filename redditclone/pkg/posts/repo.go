@@ -10,47 +10,49 @@ type PostsMemoryRepository struct {
 	AllDataWithCategories map[string]map[string]*Post
 	UserPostsData         map[string][]*Post
 	AllData               map[string]*Post
+	Revisions             map[string][]*Revision
+	index                 *searchIndex
 	mu                    *sync.RWMutex
 }
 
 func NewPostMemoryRepository() *PostsMemoryRepository {
-	allData := make(map[string]map[string]*Post)
-	allData["music"] = make(map[string]*Post)
-	allData["funny"] = make(map[string]*Post)
-	allData["videos"] = make(map[string]*Post)
-	allData["programming"] = make(map[string]*Post)
-	allData["news"] = make(map[string]*Post)
-	allData["fashion"] = make(map[string]*Post)
-
 	repo := PostsMemoryRepository{
-		AllDataWithCategories: allData,
+		AllDataWithCategories: make(map[string]map[string]*Post),
 		UserPostsData:         make(map[string][]*Post),
 		AllData:               make(map[string]*Post),
+		Revisions:             make(map[string][]*Revision),
+		index:                 newSearchIndex(),
 		mu:                    &sync.RWMutex{},
 	}
 
 	return &repo
 }
 
-var ErrWrongCategory = errors.New("wrong category")
 var ErrPostNotFound = errors.New("post not found")
 var ErrCommentNotFound = errors.New("comment not found")
 var ErrAccessDenied = errors.New("access denied")
 var ErrUserNotFound = errors.New("user not found")
+var ErrWrongPostType = errors.New("field does not match post type")
+var ErrNothingToEdit = errors.New("nothing to edit")
 
 func (repo *PostsMemoryRepository) AddPost(p *Post) error {
-	if _, ok := repo.AllDataWithCategories[p.Category]; !ok {
-		return ErrWrongCategory
-	}
-
 	repo.mu.Lock()
 	repo.AllData[p.ID] = p
-	repo.AllDataWithCategories[p.Category][p.ID] = p
+	repo.addToCategory(p)
+	repo.index.add(p)
 	repo.mu.Unlock()
 
 	return nil
 }
 
+// addToCategory indexes the post by its category; callers hold the lock.
+func (repo *PostsMemoryRepository) addToCategory(p *Post) {
+	if _, ok := repo.AllDataWithCategories[p.Category]; !ok {
+		repo.AllDataWithCategories[p.Category] = make(map[string]*Post)
+	}
+	repo.AllDataWithCategories[p.Category][p.ID] = p
+}
+
 func (repo *PostsMemoryRepository) AddUserPost(userName string, p *Post) error {
 	if _, ok := repo.UserPostsData[userName]; !ok {
 		repo.mu.Lock()
@@ -78,16 +80,26 @@ func (repo *PostsMemoryRepository) AddViews(post *Post) {
 	repo.mu.Unlock()
 }
 
-func (repo *PostsMemoryRepository) GetAllPosts() map[string]*Post {
-	return repo.AllData
+func (repo *PostsMemoryRepository) GetAllPosts() (map[string]*Post, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	posts := make(map[string]*Post, len(repo.AllData))
+	for id, p := range repo.AllData {
+		posts[id] = p
+	}
+	return posts, nil
 }
 
 func (repo *PostsMemoryRepository) GetPostsWithCategory(category string) (map[string]*Post, error) {
-	if posts, ok := repo.AllDataWithCategories[category]; !ok {
-		return nil, ErrWrongCategory
-	} else {
-		return posts, nil
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	posts := make(map[string]*Post, len(repo.AllDataWithCategories[category]))
+	for id, p := range repo.AllDataWithCategories[category] {
+		posts[id] = p
 	}
+	return posts, nil
 }
 
 func (repo *PostsMemoryRepository) AddCommentToPost(postID string, comment *Comment) error {
@@ -95,40 +107,46 @@ func (repo *PostsMemoryRepository) AddCommentToPost(postID string, comment *Comm
 		return ErrPostNotFound
 	} else {
 		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		if err := prepareReply(post.Comments, comment); err != nil {
+			return err
+		}
 		post.Comments = append(post.Comments, comment)
-		repo.mu.Unlock()
+		repo.index.add(post)
 		return nil
 	}
 }
 
-func (repo *PostsMemoryRepository) DeleteComment(post *Post, commentID string, userID string) error {
-	flag := false
-	index := -1
-	for i, comm := range post.Comments {
-		if comm.ID == commentID {
-			flag = true
-			index = i
-			break
-		}
-	}
+func (repo *PostsMemoryRepository) DeleteComment(post *Post, commentID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
 
-	if post.Comments[index].UserAuthor.ID != userID && index != -1 {
-		return ErrAccessDenied
+	target, err := post.GetComment(commentID)
+	if err != nil {
+		return err
 	}
 
-	if flag {
-		repo.mu.Lock()
-		copy(post.Comments[index:], post.Comments[index+1:])
-		post.Comments = post.Comments[:len(post.Comments)-1]
-		repo.mu.Unlock()
-		return nil
+	dropped, tombstone := planCommentDeletion(post.Comments, target)
+	if tombstone {
+		tombstoneComment(target)
 	} else {
-		return ErrCommentNotFound
+		comments := post.Comments[:0]
+		for _, comm := range post.Comments {
+			if !dropped[comm.ID] {
+				comments = append(comments, comm)
+			}
+		}
+		post.Comments = comments
 	}
-
+	repo.index.add(post)
+	return nil
 }
 
 func (repo *PostsMemoryRepository) issueScoreAndPercentage(p *Post) {
+	countScoreAndPercentage(p)
+}
+
+func countScoreAndPercentage(p *Post) {
 	downvoteScore := 0
 	upvoteScore := 0
 	p.Score = 0
@@ -152,7 +170,7 @@ func (repo *PostsMemoryRepository) issueScoreAndPercentage(p *Post) {
 	}
 }
 
-func (repo *PostsMemoryRepository) AddVote(p *Post, v *Vote, voteValue int) {
+func (repo *PostsMemoryRepository) AddVote(p *Post, v *Vote, voteValue int) error {
 	flag := false
 	index := -1
 	for i, vote := range p.Votes {
@@ -170,6 +188,7 @@ func (repo *PostsMemoryRepository) AddVote(p *Post, v *Vote, voteValue int) {
 	}
 	repo.issueScoreAndPercentage(p)
 	repo.mu.Unlock()
+	return nil
 }
 
 func (repo *PostsMemoryRepository) DeleteVote(p *Post, userID string) error {
@@ -195,13 +214,13 @@ func (repo *PostsMemoryRepository) DeleteVote(p *Post, userID string) error {
 	return nil
 }
 
-func (repo *PostsMemoryRepository) DeletePost(p *Post, userName, userID string) error {
-	if userID != p.Author.ID {
-		return ErrAccessDenied
-	}
+func (repo *PostsMemoryRepository) DeletePost(p *Post) error {
+	userName := p.Author.Username
 	repo.mu.Lock()
 	delete(repo.AllData, p.ID)
 	delete(repo.AllDataWithCategories[p.Category], p.ID)
+	delete(repo.Revisions, p.ID)
+	repo.index.remove(p.ID)
 
 	index := -1
 	for i, post := range repo.UserPostsData[userName] {
@@ -216,6 +235,60 @@ func (repo *PostsMemoryRepository) DeletePost(p *Post, userName, userID string)
 	return nil
 }
 
+func (repo *PostsMemoryRepository) SetFlair(p *Post, flair string) error {
+	repo.mu.Lock()
+	p.Flair = flair
+	repo.mu.Unlock()
+	return nil
+}
+
+func (repo *PostsMemoryRepository) SetLocked(p *Post, locked bool) error {
+	repo.mu.Lock()
+	p.Locked = locked
+	repo.mu.Unlock()
+	return nil
+}
+
+func (repo *PostsMemoryRepository) SetFiltered(p *Post, commentID string, filtered bool) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if commentID == "" {
+		p.Filtered = filtered
+		return nil
+	}
+	comm, err := p.GetComment(commentID)
+	if err != nil {
+		return err
+	}
+	comm.Filtered = filtered
+	return nil
+}
+
+func (repo *PostsMemoryRepository) Snapshot(p *Post) Post {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	return copyPost(p)
+}
+
+func (repo *PostsMemoryRepository) GetKarma(userID string) (int, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	karma := 0
+	for _, p := range repo.AllData {
+		if p.Author.ID == userID {
+			karma += p.Score
+		}
+		for _, comm := range p.Comments {
+			if comm.UserAuthor.ID == userID && !comm.Deleted {
+				karma += comm.Score
+			}
+		}
+	}
+	return karma, nil
+}
+
 func (repo *PostsMemoryRepository) GetUserPosts(userName string) ([]*Post, error) {
 	if posts, ok := repo.UserPostsData[userName]; !ok {
 		return nil, ErrUserNotFound
@@ -224,3 +297,163 @@ func (repo *PostsMemoryRepository) GetUserPosts(userName string) ([]*Post, error
 	}
 
 }
+
+func checkPostEdit(p *Post, edit *PostEdit, userID string) error {
+	if userID != p.Author.ID {
+		return ErrAccessDenied
+	}
+	if edit.Text == nil && edit.URL == nil && edit.Category == nil {
+		return ErrNothingToEdit
+	}
+	if (edit.Text != nil && p.Type != "text") || (edit.URL != nil && p.Type != "link") {
+		return ErrWrongPostType
+	}
+	return nil
+}
+
+func currentRevision(p *Post) *Revision {
+	created := p.CreatedTime
+	if p.Edited != "" {
+		created = p.Edited
+	}
+	return &Revision{Category: p.Category, Text: p.Text, URL: p.URL, Created: created}
+}
+
+func applyPostEdit(p *Post, edit *PostEdit, editedTime string) {
+	if edit.Text != nil {
+		p.Text = *edit.Text
+	}
+	if edit.URL != nil {
+		p.URL = *edit.URL
+	}
+	if edit.Category != nil {
+		p.Category = *edit.Category
+	}
+	p.Edited = editedTime
+}
+
+func (repo *PostsMemoryRepository) EditPost(p *Post, edit *PostEdit, userID, editedTime string) error {
+	if err := checkPostEdit(p, edit, userID); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.Revisions[p.ID] = append(repo.Revisions[p.ID], currentRevision(p))
+	oldCategory := p.Category
+	applyPostEdit(p, edit, editedTime)
+	if oldCategory != p.Category {
+		delete(repo.AllDataWithCategories[oldCategory], p.ID)
+		repo.addToCategory(p)
+	}
+	repo.index.add(p)
+	return nil
+}
+
+func (repo *PostsMemoryRepository) GetRevisions(postID string) ([]*Revision, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	if _, ok := repo.AllData[postID]; !ok {
+		return nil, ErrPostNotFound
+	}
+	revisions := make([]*Revision, len(repo.Revisions[postID]))
+	copy(revisions, repo.Revisions[postID])
+	return revisions, nil
+}
+
+func (repo *PostsMemoryRepository) AddCommentVote(p *Post, commentID string, v *Vote) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	comm, err := votableComment(p.Comments, commentID)
+	if err != nil {
+		return err
+	}
+	setCommentVote(comm, v)
+	return nil
+}
+
+func (repo *PostsMemoryRepository) DeleteCommentVote(p *Post, commentID, userID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	comm, err := votableComment(p.Comments, commentID)
+	if err != nil {
+		return err
+	}
+	return removeCommentVote(comm, userID)
+}
+
+func (repo *PostsMemoryRepository) ListPosts(q ListQuery) (*Listing, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	// The indexes only narrow the candidates down; every filter still
+	// applies, as in the WHERE clause of the SQLite repository.
+	var candidates []*Post
+	switch {
+	case q.Author != "":
+		candidates = repo.UserPostsData[q.Author]
+	case q.Category != "":
+		for _, p := range repo.AllDataWithCategories[q.Category] {
+			candidates = append(candidates, p)
+		}
+	default:
+		for _, p := range repo.AllData {
+			candidates = append(candidates, p)
+		}
+	}
+
+	stats := make([]RankStats, 0, len(candidates))
+	for _, p := range candidates {
+		if q.matches(p) {
+			stats = append(stats, StatsOf(p))
+		}
+	}
+	if q.Author != "" && len(stats) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	ids, after, before, err := q.page(stats)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &Listing{Posts: make([]*Post, 0, len(ids)), After: after, Before: before}
+	for _, id := range ids {
+		listing.Posts = append(listing.Posts, repo.AllData[id])
+	}
+	return listing, nil
+}
+
+func (repo *PostsMemoryRepository) SearchPosts(q SearchQuery) (*Listing, error) {
+	terms, err := q.terms()
+	if err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	hits := make([]searchHit, 0)
+	for id, score := range repo.index.search(terms) {
+		p := repo.AllData[id]
+		if !q.matches(p) {
+			continue
+		}
+		hits = append(hits, searchHit{ID: id, Score: score, Created: parseCreated(p.CreatedTime)})
+	}
+
+	ids, after, before, err := q.page(hits)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &Listing{Posts: make([]*Post, 0, len(ids)), After: after, Before: before}
+	for _, id := range ids {
+		listing.Posts = append(listing.Posts, repo.AllData[id])
+	}
+	return listing, nil
+}
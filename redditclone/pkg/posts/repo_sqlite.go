@@ -0,0 +1,837 @@
+package post
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+type PostsSQLiteRepository struct {
+	db *sql.DB
+}
+
+var postsSchema = []string{
+	`CREATE TABLE IF NOT EXISTS posts (
+		id                TEXT PRIMARY KEY,
+		type              TEXT NOT NULL,
+		title             TEXT NOT NULL,
+		category          TEXT NOT NULL,
+		text              TEXT NOT NULL DEFAULT '',
+		url               TEXT NOT NULL DEFAULT '',
+		author_id         TEXT NOT NULL,
+		author_name       TEXT NOT NULL,
+		score             INTEGER NOT NULL DEFAULT 0,
+		views             INTEGER NOT NULL DEFAULT 0,
+		upvote_percentage INTEGER NOT NULL DEFAULT 0,
+		created           TEXT NOT NULL,
+		edited            TEXT NOT NULL DEFAULT '',
+		flair             TEXT NOT NULL DEFAULT '',
+		locked            INTEGER NOT NULL DEFAULT 0,
+		filtered          INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS posts_category_idx ON posts (category)`,
+	`CREATE INDEX IF NOT EXISTS posts_author_name_idx ON posts (author_name)`,
+	`CREATE TABLE IF NOT EXISTS votes (
+		post_id TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL,
+		vote    INTEGER NOT NULL,
+		PRIMARY KEY (post_id, user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS comments (
+		id          TEXT PRIMARY KEY,
+		post_id     TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+		body        TEXT NOT NULL,
+		author_id   TEXT NOT NULL,
+		author_name TEXT NOT NULL,
+		created     TEXT NOT NULL,
+		parent_id   TEXT NOT NULL DEFAULT '',
+		depth       INTEGER NOT NULL DEFAULT 0,
+		deleted     INTEGER NOT NULL DEFAULT 0,
+		filtered    INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS comments_post_id_idx ON comments (post_id)`,
+	`CREATE TABLE IF NOT EXISTS comment_votes (
+		comment_id TEXT NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+		user_id    TEXT NOT NULL,
+		vote       INTEGER NOT NULL,
+		PRIMARY KEY (comment_id, user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS post_revisions (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id  TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+		category TEXT NOT NULL,
+		text     TEXT NOT NULL DEFAULT '',
+		url      TEXT NOT NULL DEFAULT '',
+		created  TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS post_revisions_post_id_idx ON post_revisions (post_id)`,
+	// post_authors remembers who has ever posted, so the posts of a user
+	// whose posts were all deleted are an empty list, as in memory.
+	`CREATE TABLE IF NOT EXISTS post_authors (
+		name TEXT PRIMARY KEY
+	)`,
+	`INSERT OR IGNORE INTO post_authors (name) SELECT DISTINCT author_name FROM posts`,
+}
+
+// postsSearchSchema keeps posts_fts, the full-text index of the posts, in
+// step with posts and comments. Each row has the docid of the rowid of its
+// post, so the triggers find it without scanning the index. Comments are
+// indexed as one column of the post they belong to. The triggers are
+// recreated on every start, so databases with older ones get the current
+// ones.
+var postsSearchSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts4 (
+		post_id, title, body, url, comments,
+		notindexed=post_id, tokenize=unicode61
+	)`,
+	`DROP TRIGGER IF EXISTS posts_fts_insert`,
+	`CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+		INSERT INTO posts_fts (docid, post_id, title, body, url, comments)
+			VALUES (new.rowid, new.id, new.title, new.text, new.url, '');
+	END`,
+	`DROP TRIGGER IF EXISTS posts_fts_update`,
+	`CREATE TRIGGER posts_fts_update AFTER UPDATE OF title, text, url ON posts BEGIN
+		UPDATE posts_fts SET title = new.title, body = new.text, url = new.url WHERE docid = new.rowid;
+	END`,
+	`DROP TRIGGER IF EXISTS posts_fts_delete`,
+	`CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+		DELETE FROM posts_fts WHERE docid = old.rowid;
+	END`,
+	`DROP TRIGGER IF EXISTS comments_fts_insert`,
+	`CREATE TRIGGER comments_fts_insert AFTER INSERT ON comments BEGIN
+		UPDATE posts_fts SET comments = ` + commentsDocument("new.post_id") + `
+			WHERE docid = ` + postRowid("new.post_id") + `;
+	END`,
+	`DROP TRIGGER IF EXISTS comments_fts_update`,
+	`CREATE TRIGGER comments_fts_update AFTER UPDATE OF body, deleted ON comments BEGIN
+		UPDATE posts_fts SET comments = ` + commentsDocument("new.post_id") + `
+			WHERE docid = ` + postRowid("new.post_id") + `;
+	END`,
+	`DROP TRIGGER IF EXISTS comments_fts_delete`,
+	`CREATE TRIGGER comments_fts_delete AFTER DELETE ON comments BEGIN
+		UPDATE posts_fts SET comments = ` + commentsDocument("old.post_id") + `
+			WHERE docid = ` + postRowid("old.post_id") + `;
+	END`,
+	// Drop rows whose docid is not the rowid of their post, which indexes
+	// built before the docids were kept have, and index the posts without a
+	// row: the ones stored before the search was introduced and those.
+	`DELETE FROM posts_fts WHERE docid NOT IN
+		(SELECT f.docid FROM posts_fts f JOIN posts p ON p.rowid = f.docid AND p.id = f.post_id)`,
+	`INSERT INTO posts_fts (docid, post_id, title, body, url, comments)
+		SELECT p.rowid, p.id, p.title, p.text, p.url, ` + commentsDocument("p.id") + ` FROM posts p
+		WHERE p.rowid NOT IN (SELECT docid FROM posts_fts)`,
+}
+
+// postRowid is the expression for the rowid of the post with the given id.
+func postRowid(postID string) string {
+	return `(SELECT rowid FROM posts WHERE id = ` + postID + `)`
+}
+
+// commentsDocument is the expression for the comments column of the post
+// with the given id.
+func commentsDocument(postID string) string {
+	return `coalesce((SELECT group_concat(body, ' ') FROM comments
+		WHERE post_id = ` + postID + ` AND deleted = 0), '')`
+}
+
+// postsMigrations add columns introduced after the first schema to databases
+// created before them.
+var postsMigrations = []struct {
+	table, column, definition string
+}{
+	{"posts", "edited", "TEXT NOT NULL DEFAULT ''"},
+	{"comments", "parent_id", "TEXT NOT NULL DEFAULT ''"},
+	{"comments", "depth", "INTEGER NOT NULL DEFAULT 0"},
+	{"comments", "deleted", "INTEGER NOT NULL DEFAULT 0"},
+	{"posts", "flair", "TEXT NOT NULL DEFAULT ''"},
+	{"posts", "locked", "INTEGER NOT NULL DEFAULT 0"},
+	{"posts", "filtered", "INTEGER NOT NULL DEFAULT 0"},
+	{"comments", "filtered", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+const postColumns = `id, type, title, category, text, url, author_id, author_name,
+	score, views, upvote_percentage, created, edited, flair, locked, filtered`
+
+func NewPostSQLiteRepository(db *sql.DB) (*PostsSQLiteRepository, error) {
+	for _, stmt := range postsSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range postsMigrations {
+		ok, err := hasColumn(db, m.table, m.column)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			continue
+		}
+		if _, err = db.Exec(`ALTER TABLE ` + m.table + ` ADD COLUMN ` + m.column + ` ` + m.definition); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, stmt := range postsSearchSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &PostsSQLiteRepository{db: db}, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPost(row rowScanner) (*Post, error) {
+	p := &Post{}
+	err := row.Scan(&p.ID, &p.Type, &p.Title, &p.Category, &p.Text, &p.URL,
+		&p.Author.ID, &p.Author.Username, &p.Score, &p.Views, &p.UpvotePercentage, &p.CreatedTime, &p.Edited,
+		&p.Flair, &p.Locked, &p.Filtered)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (repo *PostsSQLiteRepository) loadVotes(p *Post) error {
+	rows, err := repo.db.Query(`SELECT user_id, vote FROM votes WHERE post_id = ? ORDER BY rowid`, p.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	p.Votes = make([]*Vote, 0)
+	for rows.Next() {
+		v := &Vote{}
+		if err = rows.Scan(&v.UserID, &v.Vote); err != nil {
+			return err
+		}
+		p.Votes = append(p.Votes, v)
+	}
+	return rows.Err()
+}
+
+const commentColumns = `id, body, author_id, author_name, created, parent_id, depth, deleted, filtered`
+
+func (repo *PostsSQLiteRepository) loadComments(p *Post) error {
+	rows, err := repo.db.Query(`SELECT `+commentColumns+` FROM comments WHERE post_id = ? ORDER BY rowid`, p.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	p.Comments = make([]*Comment, 0)
+	for rows.Next() {
+		c := &Comment{}
+		err = rows.Scan(&c.ID, &c.Body, &c.UserAuthor.ID, &c.UserAuthor.Username, &c.CreatedTime,
+			&c.ParentID, &c.Depth, &c.Deleted, &c.Filtered)
+		if err != nil {
+			return err
+		}
+		c.Votes = make([]*Vote, 0)
+		p.Comments = append(p.Comments, c)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	return repo.loadCommentVotes(p)
+}
+
+func (repo *PostsSQLiteRepository) loadCommentVotes(p *Post) error {
+	rows, err := repo.db.Query(`SELECT v.comment_id, v.user_id, v.vote FROM comment_votes v
+		JOIN comments c ON c.id = v.comment_id WHERE c.post_id = ? ORDER BY v.rowid`, p.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID string
+		v := &Vote{}
+		if err = rows.Scan(&commentID, &v.UserID, &v.Vote); err != nil {
+			return err
+		}
+		if comm := findComment(p.Comments, commentID); comm != nil {
+			comm.Votes = append(comm.Votes, v)
+		}
+	}
+	for _, comm := range p.Comments {
+		countCommentScore(comm)
+	}
+	return rows.Err()
+}
+
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertComment(exec sqlExecer, postID string, c *Comment) error {
+	_, err := exec.Exec(`INSERT INTO comments (`+commentColumns+`, post_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.Body, c.UserAuthor.ID, c.UserAuthor.Username, c.CreatedTime, c.ParentID, c.Depth, c.Deleted,
+		c.Filtered, postID)
+	return err
+}
+
+func (repo *PostsSQLiteRepository) loadDetails(p *Post) error {
+	if err := repo.loadVotes(p); err != nil {
+		return err
+	}
+	return repo.loadComments(p)
+}
+
+func (repo *PostsSQLiteRepository) queryPosts(query string, args ...any) ([]*Post, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]*Post, 0)
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, p := range posts {
+		if err = repo.loadDetails(p); err != nil {
+			return nil, err
+		}
+	}
+	return posts, nil
+}
+
+func postsToMap(posts []*Post) map[string]*Post {
+	data := make(map[string]*Post, len(posts))
+	for _, p := range posts {
+		data[p.ID] = p
+	}
+	return data
+}
+
+func (repo *PostsSQLiteRepository) AddPost(p *Post) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	_, err = tx.Exec(`INSERT INTO posts (`+postColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.Type, p.Title, p.Category, p.Text, p.URL, p.Author.ID, p.Author.Username,
+		p.Score, p.Views, p.UpvotePercentage, p.CreatedTime, p.Edited, p.Flair, p.Locked, p.Filtered)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range p.Votes {
+		_, err = tx.Exec(`INSERT INTO votes (post_id, user_id, vote) VALUES (?, ?, ?)`, p.ID, v.UserID, v.Vote)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range p.Comments {
+		if err = insertComment(tx, p.ID, c); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Posts already carry their author, so there is no separate index to maintain.
+func (repo *PostsSQLiteRepository) AddUserPost(userName string, p *Post) error {
+	_, err := repo.db.Exec(`INSERT OR IGNORE INTO post_authors (name) VALUES (?)`, userName)
+	return err
+}
+
+func (repo *PostsSQLiteRepository) GetPost(postID string) (*Post, error) {
+	row := repo.db.QueryRow(`SELECT `+postColumns+` FROM posts WHERE id = ?`, postID)
+	p, err := scanPost(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = repo.loadDetails(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (repo *PostsSQLiteRepository) AddViews(post *Post) {
+	row := repo.db.QueryRow(`UPDATE posts SET views = views + 1 WHERE id = ? RETURNING views`, post.ID)
+	row.Scan(&post.Views) //nolint:errcheck
+}
+
+func (repo *PostsSQLiteRepository) GetAllPosts() (map[string]*Post, error) {
+	posts, err := repo.queryPosts(`SELECT ` + postColumns + ` FROM posts`)
+	if err != nil {
+		return nil, err
+	}
+	return postsToMap(posts), nil
+}
+
+func (repo *PostsSQLiteRepository) GetPostsWithCategory(category string) (map[string]*Post, error) {
+	posts, err := repo.queryPosts(`SELECT `+postColumns+` FROM posts WHERE category = ?`, category)
+	if err != nil {
+		return nil, err
+	}
+	return postsToMap(posts), nil
+}
+
+func (repo *PostsSQLiteRepository) AddCommentToPost(postID string, comment *Comment) error {
+	p, err := repo.GetPost(postID)
+	if err != nil {
+		return err
+	}
+
+	if err = prepareReply(p.Comments, comment); err != nil {
+		return err
+	}
+	return insertComment(repo.db, postID, comment)
+}
+
+func (repo *PostsSQLiteRepository) DeleteComment(post *Post, commentID string) error {
+	if err := repo.loadComments(post); err != nil {
+		return err
+	}
+
+	target, err := post.GetComment(commentID)
+	if err != nil {
+		return err
+	}
+
+	dropped, tombstone := planCommentDeletion(post.Comments, target)
+	if tombstone {
+		_, err = repo.db.Exec(`UPDATE comments SET body = ?, author_id = '', author_name = ?, deleted = 1
+			WHERE id = ?`, DeletedCommentBody, DeletedCommentBody, commentID)
+		if err != nil {
+			return err
+		}
+		return repo.loadComments(post)
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for id := range dropped {
+		if _, err = tx.Exec(`DELETE FROM comments WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	return repo.loadComments(post)
+}
+
+func (repo *PostsSQLiteRepository) issueScoreAndPercentage(p *Post) {
+	countScoreAndPercentage(p)
+}
+
+func (repo *PostsSQLiteRepository) storeScore(p *Post) error {
+	if err := repo.loadVotes(p); err != nil {
+		return err
+	}
+	repo.issueScoreAndPercentage(p)
+
+	_, err := repo.db.Exec(`UPDATE posts SET score = ?, upvote_percentage = ? WHERE id = ?`,
+		p.Score, p.UpvotePercentage, p.ID)
+	return err
+}
+
+func (repo *PostsSQLiteRepository) AddVote(p *Post, v *Vote, voteValue int) error {
+	_, err := repo.db.Exec(`INSERT INTO votes (post_id, user_id, vote) VALUES (?, ?, ?)
+		ON CONFLICT (post_id, user_id) DO UPDATE SET vote = excluded.vote`, p.ID, v.UserID, voteValue)
+	if err != nil {
+		return err
+	}
+	return repo.storeScore(p)
+}
+
+func (repo *PostsSQLiteRepository) DeleteVote(p *Post, userID string) error {
+	res, err := repo.db.Exec(`DELETE FROM votes WHERE post_id = ? AND user_id = ?`, p.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAccessDenied
+	}
+
+	return repo.storeScore(p)
+}
+
+func (repo *PostsSQLiteRepository) DeletePost(p *Post) error {
+	_, err := repo.db.Exec(`DELETE FROM posts WHERE id = ?`, p.ID)
+	return err
+}
+
+func (repo *PostsSQLiteRepository) SetFlair(p *Post, flair string) error {
+	if _, err := repo.db.Exec(`UPDATE posts SET flair = ? WHERE id = ?`, flair, p.ID); err != nil {
+		return err
+	}
+	p.Flair = flair
+	return nil
+}
+
+func (repo *PostsSQLiteRepository) SetLocked(p *Post, locked bool) error {
+	if _, err := repo.db.Exec(`UPDATE posts SET locked = ? WHERE id = ?`, locked, p.ID); err != nil {
+		return err
+	}
+	p.Locked = locked
+	return nil
+}
+
+func (repo *PostsSQLiteRepository) SetFiltered(p *Post, commentID string, filtered bool) error {
+	if commentID == "" {
+		if _, err := repo.db.Exec(`UPDATE posts SET filtered = ? WHERE id = ?`, filtered, p.ID); err != nil {
+			return err
+		}
+		p.Filtered = filtered
+		return nil
+	}
+
+	res, err := repo.db.Exec(`UPDATE comments SET filtered = ? WHERE id = ? AND post_id = ? AND deleted = 0`,
+		filtered, commentID, p.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrCommentNotFound
+	}
+	return repo.loadComments(p)
+}
+
+// Snapshot only copies: posts of this repository belong to their caller.
+func (repo *PostsSQLiteRepository) Snapshot(p *Post) Post {
+	return copyPost(p)
+}
+
+func (repo *PostsSQLiteRepository) GetKarma(userID string) (int, error) {
+	var karma int
+	err := repo.db.QueryRow(`SELECT
+		(SELECT COALESCE(SUM(score), 0) FROM posts WHERE author_id = ?) +
+		(SELECT COALESCE(SUM(cv.vote), 0) FROM comment_votes cv JOIN comments c ON c.id = cv.comment_id
+			WHERE c.author_id = ? AND c.deleted = 0)`, userID, userID).Scan(&karma)
+	return karma, err
+}
+
+func (repo *PostsSQLiteRepository) GetUserPosts(userName string) ([]*Post, error) {
+	posts, err := repo.queryPosts(`SELECT `+postColumns+` FROM posts WHERE author_name = ? ORDER BY rowid`, userName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(posts) == 0 {
+		var posted bool
+		err = repo.db.QueryRow(`SELECT COUNT(*) > 0 FROM post_authors WHERE name = ?`, userName).Scan(&posted)
+		if err != nil {
+			return nil, err
+		}
+		if !posted {
+			return nil, ErrUserNotFound
+		}
+	}
+	return posts, nil
+}
+
+func (repo *PostsSQLiteRepository) EditPost(p *Post, edit *PostEdit, userID, editedTime string) error {
+	if err := checkPostEdit(p, edit, userID); err != nil {
+		return err
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	rev := currentRevision(p)
+	_, err = tx.Exec(`INSERT INTO post_revisions (post_id, category, text, url, created) VALUES (?, ?, ?, ?, ?)`,
+		p.ID, rev.Category, rev.Text, rev.URL, rev.Created)
+	if err != nil {
+		return err
+	}
+
+	edited := *p
+	applyPostEdit(&edited, edit, editedTime)
+	_, err = tx.Exec(`UPDATE posts SET category = ?, text = ?, url = ?, edited = ? WHERE id = ?`,
+		edited.Category, edited.Text, edited.URL, edited.Edited, p.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	applyPostEdit(p, edit, editedTime)
+	return nil
+}
+
+func (repo *PostsSQLiteRepository) GetRevisions(postID string) ([]*Revision, error) {
+	if _, err := repo.GetPost(postID); err != nil {
+		return nil, err
+	}
+
+	rows, err := repo.db.Query(`SELECT category, text, url, created FROM post_revisions
+		WHERE post_id = ? ORDER BY id`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]*Revision, 0)
+	for rows.Next() {
+		rev := &Revision{}
+		if err = rows.Scan(&rev.Category, &rev.Text, &rev.URL, &rev.Created); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func (repo *PostsSQLiteRepository) AddCommentVote(p *Post, commentID string, v *Vote) error {
+	if err := repo.loadComments(p); err != nil {
+		return err
+	}
+	if _, err := votableComment(p.Comments, commentID); err != nil {
+		return err
+	}
+
+	_, err := repo.db.Exec(`INSERT INTO comment_votes (comment_id, user_id, vote) VALUES (?, ?, ?)
+		ON CONFLICT (comment_id, user_id) DO UPDATE SET vote = excluded.vote`, commentID, v.UserID, v.Vote)
+	if err != nil {
+		return err
+	}
+	return repo.loadComments(p)
+}
+
+func (repo *PostsSQLiteRepository) DeleteCommentVote(p *Post, commentID, userID string) error {
+	if err := repo.loadComments(p); err != nil {
+		return err
+	}
+	if _, err := votableComment(p.Comments, commentID); err != nil {
+		return err
+	}
+
+	res, err := repo.db.Exec(`DELETE FROM comment_votes WHERE comment_id = ? AND user_id = ?`, commentID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAccessDenied
+	}
+	return repo.loadComments(p)
+}
+
+// placeholders returns n comma separated parameter markers for an IN list.
+func placeholders(n int) string {
+	if n == 0 {
+		return `NULL`
+	}
+	return `?` + strings.Repeat(`, ?`, n-1)
+}
+
+// ListPosts ranks on aggregated counters and loads only the posts of the
+// requested page.
+func (repo *PostsSQLiteRepository) ListPosts(q ListQuery) (*Listing, error) {
+	query := `SELECT p.id, p.score, p.created,
+		(SELECT COUNT(*) FROM votes v WHERE v.post_id = p.id AND v.vote > 0),
+		(SELECT COUNT(*) FROM votes v WHERE v.post_id = p.id AND v.vote < 0),
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted = 0 AND c.filtered = 0)
+		FROM posts p WHERE p.filtered = 0`
+	var args []any
+	if q.Category != "" {
+		query += ` AND p.category = ?`
+		args = append(args, q.Category)
+	}
+	if q.Author != "" {
+		query += ` AND p.author_name = ?`
+		args = append(args, q.Author)
+	}
+	if q.Categories != nil {
+		query += ` AND p.category IN (` + placeholders(len(q.Categories)) + `)`
+		for _, category := range q.Categories {
+			args = append(args, category)
+		}
+	}
+	if len(q.Exclude) > 0 {
+		query += ` AND p.category NOT IN (` + placeholders(len(q.Exclude)) + `)`
+		for _, category := range q.Exclude {
+			args = append(args, category)
+		}
+	}
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]RankStats, 0)
+	for rows.Next() {
+		var s RankStats
+		var created string
+		if err = rows.Scan(&s.ID, &s.Score, &created, &s.Ups, &s.Downs, &s.Comments); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.Created = parseCreated(created)
+		stats = append(stats, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if q.Author != "" && len(stats) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	ids, after, before, err := q.page(stats)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &Listing{Posts: make([]*Post, 0, len(ids)), After: after, Before: before}
+	for _, id := range ids {
+		p, err := repo.GetPost(id)
+		if err != nil {
+			return nil, err
+		}
+		listing.Posts = append(listing.Posts, p)
+	}
+	return listing, nil
+}
+
+// matchScore computes the relevance of a row from the FTS matchinfo 'pcnalx'
+// blob. Column 0 is the post id, which is not indexed.
+func matchScore(blob []byte) float64 {
+	info := make([]float64, len(blob)/4)
+	for i := range info {
+		info[i] = float64(binary.NativeEndian.Uint32(blob[i*4:]))
+	}
+
+	phrases, columns, docs := int(info[0]), int(info[1]), info[2]
+	avg, length, hits := info[3:3+columns], info[3+columns:3+2*columns], info[3+2*columns:]
+	score := 0.0
+	for i := 0; i < phrases; i++ {
+		for j := 1; j < columns; j++ {
+			x := hits[3*(i*columns+j):]
+			score += fieldWeights[j-1] * bm25(x[0], x[2], docs, length[j], avg[j])
+		}
+	}
+	return score
+}
+
+func (repo *PostsSQLiteRepository) SearchPosts(q SearchQuery) (*Listing, error) {
+	terms, err := q.terms()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT p.id, p.created, matchinfo(posts_fts, 'pcnalx')
+		FROM posts_fts JOIN posts p ON p.rowid = posts_fts.docid
+		WHERE posts_fts MATCH ? AND p.filtered = 0`
+	args := []any{`"` + strings.Join(terms, `" "`) + `"`}
+	if q.Category != "" {
+		query += ` AND p.category = ?`
+		args = append(args, q.Category)
+	}
+	if q.Author != "" {
+		query += ` AND p.author_name = ?`
+		args = append(args, q.Author)
+	}
+	if q.Type != "" {
+		query += ` AND p.type = ?`
+		args = append(args, q.Type)
+	}
+	if len(q.Exclude) > 0 {
+		query += ` AND p.category NOT IN (` + placeholders(len(q.Exclude)) + `)`
+		for _, category := range q.Exclude {
+			args = append(args, category)
+		}
+	}
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]searchHit, 0)
+	for rows.Next() {
+		var hit searchHit
+		var created string
+		var info []byte
+		if err = rows.Scan(&hit.ID, &created, &info); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hit.Created = parseCreated(created)
+		if !q.inDateRange(hit.Created) {
+			continue
+		}
+		hit.Score = matchScore(info)
+		hits = append(hits, hit)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids, after, before, err := q.page(hits)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &Listing{Posts: make([]*Post, 0, len(ids)), After: after, Before: before}
+	for _, id := range ids {
+		p, err := repo.GetPost(id)
+		if err != nil {
+			return nil, err
+		}
+		listing.Posts = append(listing.Posts, p)
+	}
+	return listing, nil
+}
@@ -0,0 +1,258 @@
+package post
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrEmptySearch = errors.New("empty search query")
+
+const (
+	SearchSortRelevance = "relevance"
+	SearchSortNew       = "new"
+)
+
+// Fields of the search document of a post. Comments holds the bodies of all
+// comments that are not deleted.
+const (
+	fieldTitle = iota
+	fieldText
+	fieldURL
+	fieldComments
+	numFields
+)
+
+// fieldWeights make a match in the title count more than one in comments.
+var fieldWeights = [numFields]float64{3, 1, 1, 0.5}
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// SearchQuery finds posts containing every word of Text. The other fields
+// are optional filters; From and To bound the creation time, To exclusive.
+type SearchQuery struct {
+	Text     string
+	Category string
+	Author   string
+	Type     string
+	From     time.Time
+	To       time.Time
+	Sort     string
+	Exclude  []string
+	After    string
+	Before   string
+	Limit    int
+}
+
+// Tokenize splits text into lowercase words, the unit of the search index.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func (q SearchQuery) terms() ([]string, error) {
+	seen := make(map[string]bool)
+	terms := make([]string, 0)
+	for _, t := range Tokenize(q.Text) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+	return terms, nil
+}
+
+func (q SearchQuery) sortMode() (string, error) {
+	switch q.Sort {
+	case "", SearchSortRelevance:
+		return SearchSortRelevance, nil
+	case SearchSortNew:
+		return SearchSortNew, nil
+	default:
+		return "", ErrUnknownSort
+	}
+}
+
+// inDateRange checks the filters storages do not apply themselves.
+func (q SearchQuery) inDateRange(created time.Time) bool {
+	if !q.From.IsZero() && created.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !created.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+func (q SearchQuery) matches(p *Post) bool {
+	switch {
+	case q.Category != "" && p.Category != q.Category:
+		return false
+	case q.Author != "" && p.Author.Username != q.Author:
+		return false
+	case q.Type != "" && p.Type != q.Type:
+		return false
+	case p.Filtered:
+		return false
+	case q.excluded(p.Category):
+		return false
+	}
+	return q.inDateRange(parseCreated(p.CreatedTime))
+}
+
+func (q SearchQuery) excluded(category string) bool {
+	return ListQuery{Exclude: q.Exclude}.excluded(category)
+}
+
+// bm25 scores one term in one field: tf is the count of the term in the
+// field, df the number of posts with the term.
+func bm25(tf, df, docs, length, avgLength float64) float64 {
+	if tf == 0 {
+		return 0
+	}
+	idf := math.Log(1 + (docs-df+0.5)/(df+0.5))
+	norm := 1 - bm25B
+	if avgLength > 0 {
+		norm += bm25B * length / avgLength
+	}
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+}
+
+type searchHit struct {
+	ID      string
+	Score   float64
+	Created time.Time
+}
+
+// page orders the hits and cuts out the requested page.
+func (q SearchQuery) page(hits []searchHit) (ids []string, after, before string, err error) {
+	mode, err := q.sortMode()
+	if err != nil {
+		return nil, "", "", err
+	}
+	pr := pageRequest{Sort: mode, After: q.After, Before: q.Before, Limit: q.Limit}
+	pos, now, err := pr.start()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	items := make([]rankedItem, 0, len(hits))
+	for _, hit := range hits {
+		item := rankedItem{Created: hit.Created.UnixNano(), ID: hit.ID}
+		if mode == SearchSortRelevance {
+			item.Key = hit.Score
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].before(items[j])
+	})
+
+	ids, after, before = pr.cut(items, pos, now)
+	return ids, after, before, nil
+}
+
+func documentFields(p *Post) [numFields]string {
+	comments := make([]string, 0, len(p.Comments))
+	for _, comm := range p.Comments {
+		if !comm.Deleted {
+			comments = append(comments, comm.Body)
+		}
+	}
+	return [numFields]string{p.Title, p.Text, p.URL, strings.Join(comments, " ")}
+}
+
+type indexedDoc struct {
+	terms  [numFields]map[string]int
+	length [numFields]int
+}
+
+// searchIndex is the inverted index of the memory storage: postings map a
+// word to the posts containing it.
+type searchIndex struct {
+	docs     map[string]*indexedDoc
+	postings map[string]map[string]bool
+	total    [numFields]int
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		docs:     make(map[string]*indexedDoc),
+		postings: make(map[string]map[string]bool),
+	}
+}
+
+// add indexes the post, replacing what was indexed for it before.
+func (idx *searchIndex) add(p *Post) {
+	idx.remove(p.ID)
+
+	doc := &indexedDoc{}
+	for f, text := range documentFields(p) {
+		doc.terms[f] = make(map[string]int)
+		for _, t := range Tokenize(text) {
+			doc.terms[f][t]++
+			doc.length[f]++
+			if _, ok := idx.postings[t]; !ok {
+				idx.postings[t] = make(map[string]bool)
+			}
+			idx.postings[t][p.ID] = true
+		}
+		idx.total[f] += doc.length[f]
+	}
+	idx.docs[p.ID] = doc
+}
+
+func (idx *searchIndex) remove(postID string) {
+	doc, ok := idx.docs[postID]
+	if !ok {
+		return
+	}
+	for f := range doc.terms {
+		for t := range doc.terms[f] {
+			delete(idx.postings[t], postID)
+			if len(idx.postings[t]) == 0 {
+				delete(idx.postings, t)
+			}
+		}
+		idx.total[f] -= doc.length[f]
+	}
+	delete(idx.docs, postID)
+}
+
+// search returns the scores of the posts containing all the terms.
+func (idx *searchIndex) search(terms []string) map[string]float64 {
+	scores := make(map[string]float64)
+	for id := range idx.postings[terms[0]] {
+		scores[id] = 0
+	}
+	for _, t := range terms[1:] {
+		for id := range scores {
+			if !idx.postings[t][id] {
+				delete(scores, id)
+			}
+		}
+	}
+
+	docs := float64(len(idx.docs))
+	for id := range scores {
+		doc := idx.docs[id]
+		for _, t := range terms {
+			df := float64(len(idx.postings[t]))
+			for f := 0; f < numFields; f++ {
+				avg := float64(idx.total[f]) / docs
+				scores[id] += fieldWeights[f] * bm25(float64(doc.terms[f][t]), df, docs, float64(doc.length[f]), avg)
+			}
+		}
+	}
+	return scores
+}
@@ -0,0 +1,98 @@
+package post
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+var ErrUnknownSort = errors.New("unknown sort")
+
+const (
+	CommentSortBest          = "best"
+	CommentSortTop           = "top"
+	CommentSortNew           = "new"
+	CommentSortOld           = "old"
+	CommentSortControversial = "controversial"
+)
+
+func parseCreated(created string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, created)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func countVotes(votes []*Vote) (ups, downs int) {
+	for _, v := range votes {
+		if v.Vote == UpvoteValue {
+			ups++
+		} else {
+			downs++
+		}
+	}
+	return ups, downs
+}
+
+// wilsonScore is the lower bound of the 95% confidence interval for the
+// share of upvotes, so a few lucky votes do not beat many good ones.
+func wilsonScore(ups, downs int) float64 {
+	n := float64(ups + downs)
+	if n == 0 {
+		return 0
+	}
+	const z = 1.96
+	phat := float64(ups) / n
+	return (phat + z*z/(2*n) - z*math.Sqrt((phat*(1-phat)+z*z/(4*n))/n)) / (1 + z*z/n)
+}
+
+// controversy grows with the number of votes and with how evenly they are
+// split between up and down.
+func controversy(ups, downs int) float64 {
+	if ups <= 0 || downs <= 0 {
+		return 0
+	}
+	magnitude := float64(ups + downs)
+	balance := float64(downs) / float64(ups)
+	if ups <= downs {
+		balance = float64(ups) / float64(downs)
+	}
+	return math.Pow(magnitude, balance)
+}
+
+// SortComments orders comments in place; replies keep following the same
+// order inside their parent when the tree is built.
+func SortComments(comments []*Comment, mode string) error {
+	var key func(c *Comment) float64
+	switch mode {
+	case CommentSortBest:
+		key = func(c *Comment) float64 { return wilsonScore(countVotes(c.Votes)) }
+	case CommentSortTop:
+		key = func(c *Comment) float64 { return float64(c.Score) }
+	case CommentSortControversial:
+		key = func(c *Comment) float64 { return controversy(countVotes(c.Votes)) }
+	case CommentSortNew:
+		sort.SliceStable(comments, func(i, j int) bool {
+			return parseCreated(comments[i].CreatedTime).After(parseCreated(comments[j].CreatedTime))
+		})
+		return nil
+	case CommentSortOld:
+		sort.SliceStable(comments, func(i, j int) bool {
+			return parseCreated(comments[i].CreatedTime).Before(parseCreated(comments[j].CreatedTime))
+		})
+		return nil
+	default:
+		return ErrUnknownSort
+	}
+
+	sort.SliceStable(comments, func(i, j int) bool {
+		ki, kj := key(comments[i]), key(comments[j])
+		if ki != kj {
+			return ki > kj
+		}
+		return parseCreated(comments[i].CreatedTime).Before(parseCreated(comments[j].CreatedTime))
+	})
+	return nil
+}
@@ -2,39 +2,121 @@ package session
 
 import (
 	"errors"
+	"net"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 )
 
+type Config struct {
+	// AbsoluteTimeout limits the session lifetime since login.
+	AbsoluteTimeout time.Duration
+	// IdleTimeout ends sessions without requests for that long; zero disables it.
+	IdleTimeout time.Duration
+	// Sliding pushes the cookie expiry forward on every request.
+	Sliding bool
+}
+
+var DefaultConfig = Config{
+	AbsoluteTimeout: 24 * time.Hour,
+	IdleTimeout:     6 * time.Hour,
+	Sliding:         true,
+}
+
 type SessionManager struct {
-	data map[string]*Session
-	mu   sync.RWMutex
+	store  Store
+	config Config
 }
 
 var ErrSessionNotFound = errors.New("Session Not Found")
+var ErrSessionExpired = errors.New("Session Expired")
 
-func NewSessionsManager() *SessionManager {
+func NewSessionsManager(store Store, config Config) *SessionManager {
 	return &SessionManager{
-		data: make(map[string]*Session, 0),
-		mu:   sync.RWMutex{},
+		store:  store,
+		config: config,
+	}
+}
+
+func (manager *SessionManager) expiresAt(sess *Session) time.Time {
+	expires := sess.CreatedAt.Add(manager.config.AbsoluteTimeout)
+	if manager.config.IdleTimeout > 0 {
+		if idle := sess.LastSeen.Add(manager.config.IdleTimeout); idle.Before(expires) {
+			return idle
+		}
+	}
+	return expires
+}
+
+// cookieExpires is when the browser drops the cookie. Without sliding the
+// cookie is never renewed, so it has to last as long as the session could;
+// the server still ends the session when it is idle for too long.
+func (manager *SessionManager) cookieExpires(sess *Session) time.Time {
+	if !manager.config.Sliding {
+		return sess.CreatedAt.Add(manager.config.AbsoluteTimeout)
+	}
+	return manager.expiresAt(sess)
+}
+
+func (manager *SessionManager) setCookie(w http.ResponseWriter, sess *Session) {
+	http.SetCookie(w, &http.Cookie{Name: "session_id",
+		Value:    sess.ID,
+		Expires:  manager.cookieExpires(sess),
+		Path:     "/",
+		HttpOnly: true})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
+	return host
 }
 
-func (manager *SessionManager) CreateSession(w http.ResponseWriter, name, userID string) *Session {
-	sess := NewSession(name, userID)
+func (manager *SessionManager) CreateSession(w http.ResponseWriter, r *http.Request, name, userID string) (*Session, error) {
+	sess := NewSession(name, userID, r.UserAgent(), clientIP(r))
+	if sess == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	if err := manager.store.Save(sess, manager.expiresAt(sess)); err != nil {
+		return nil, err
+	}
+
+	manager.setCookie(w, sess)
+	return sess, nil
+}
+
+// GetSession looks a session up by id, enforcing the timeouts and
+// recording the activity.
+func (manager *SessionManager) GetSession(id string) (*Session, error) {
+	return manager.activeSession(manager.store.Get(id))
+}
 
-	manager.mu.Lock()
-	manager.data[sess.ID] = sess
-	manager.mu.Unlock()
+// GetSessionByHandle is GetSession for the public handle of the session,
+// as access and refresh tokens carry it.
+func (manager *SessionManager) GetSessionByHandle(handle string) (*Session, error) {
+	return manager.activeSession(manager.store.GetByHandle(handle))
+}
+
+func (manager *SessionManager) activeSession(sess *Session, err error) (*Session, error) {
+	if err != nil {
+		return nil, err
+	}
 
-	cookie := &http.Cookie{Name: "session_id",
-		Value:   sess.ID,
-		Expires: time.Now().Add(24 * time.Hour),
-		Path:    "/"}
+	now := time.Now()
+	if !now.Before(manager.expiresAt(sess)) {
+		manager.store.Delete(sess.ID) //nolint:errcheck
+		return nil, ErrSessionExpired
+	}
 
-	http.SetCookie(w, cookie)
-	return sess
+	sess.LastSeen = now
+	if err = manager.store.Touch(sess, manager.expiresAt(sess)); err != nil {
+		return nil, err
+	}
+	return sess, nil
 }
 
 func (manager *SessionManager) CheckSession(r *http.Request) (*Session, error) {
@@ -42,29 +124,102 @@ func (manager *SessionManager) CheckSession(r *http.Request) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
+	return manager.GetSession(sessID.Value)
+}
 
-	if sess, ok := manager.data[sessID.Value]; ok {
-		return sess, nil
+func (manager *SessionManager) ListSessions(userID string) ([]*Session, error) {
+	sessions, err := manager.store.List(userID)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, ErrSessionNotFound
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
 }
 
-func (manager *SessionManager) DestroySession(w http.ResponseWriter, r *http.Request) error {
-	sessID, err := r.Cookie("session_id")
+// DestroyUserSession ends the session of a user with the given handle;
+// sessions of other users are reported as not found.
+func (manager *SessionManager) DestroyUserSession(userID, handle string) error {
+	sess, err := manager.store.GetByHandle(handle)
 	if err != nil {
 		return err
 	}
-	manager.mu.Lock()
-	delete(manager.data, sessID.Value)
-	manager.mu.Unlock()
+	if sess.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return manager.store.Delete(sess.ID)
+}
+
+func (manager *SessionManager) DestroyAllSessions(userID string) (int, error) {
+	sessions, err := manager.store.List(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sess := range sessions {
+		if err = manager.store.Delete(sess.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(sessions), nil
+}
 
+func (manager *SessionManager) ClearCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:    "session_id",
 		Value:   "",
 		Path:    "/",
 		Expires: time.Now().Add(-1 * time.Hour),
 	})
+}
+
+// RenewCookie moves the cookie expiry forward after a successful
+// CheckSession when sliding expiration is enabled.
+func (manager *SessionManager) RenewCookie(w http.ResponseWriter, sess *Session) {
+	if !manager.config.Sliding || sess == nil || sess.ID == "" {
+		return
+	}
+	manager.setCookie(w, sess)
+}
+
+func (manager *SessionManager) DestroySession(w http.ResponseWriter, r *http.Request) error {
+	sessID, err := r.Cookie("session_id")
+	if err != nil {
+		return err
+	}
+	if err = manager.store.Delete(sessID.Value); err != nil {
+		return err
+	}
 
+	manager.ClearCookie(w)
 	return nil
 }
+
+// StartJanitor evicts expired sessions every interval until the returned
+// stop function is called. An interval of zero or less disables it.
+func (manager *SessionManager) StartJanitor(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				manager.store.Sweep(now) //nolint:errcheck
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,106 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Refresh tokens look like "<session handle>.<secret>". A session is the token
+// family: only the hash of the latest secret is kept, so presenting an older
+// secret means the token was replayed and the whole session is revoked.
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// SpentRefreshHashes is how many replaced secrets a session remembers to
+// recognise a replay; anything else is merely an invalid token, so guessing
+// at the token of someone else's session does not end it.
+const SpentRefreshHashes = 32
+
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// swapRefreshHash is the compare-and-set of the stores on a session they
+// hold locked: it moves the session to newHash when oldHash is current and
+// tells a replayed secret from an unknown one otherwise.
+func swapRefreshHash(sess *Session, oldHash, newHash string) error {
+	if subtle.ConstantTimeCompare([]byte(sess.RefreshHash), []byte(oldHash)) != 1 {
+		for _, spent := range sess.SpentRefreshHashes {
+			if subtle.ConstantTimeCompare([]byte(spent), []byte(oldHash)) == 1 {
+				return ErrRefreshTokenReused
+			}
+		}
+		return ErrInvalidRefreshToken
+	}
+
+	if oldHash != "" {
+		sess.SpentRefreshHashes = append(sess.SpentRefreshHashes, oldHash)
+		if extra := len(sess.SpentRefreshHashes) - SpentRefreshHashes; extra > 0 {
+			sess.SpentRefreshHashes = append([]string(nil), sess.SpentRefreshHashes[extra:]...)
+		}
+	}
+	sess.RefreshHash = newHash
+	return nil
+}
+
+func (manager *SessionManager) IssueRefreshToken(sess *Session) (string, error) {
+	return manager.replaceRefreshToken(sess, sess.RefreshHash)
+}
+
+// replaceRefreshToken starts the next token of the family, provided the
+// stored hash is still oldHash.
+func (manager *SessionManager) replaceRefreshToken(sess *Session, oldHash string) (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(bytes)
+
+	hash := hashRefreshSecret(secret)
+	if err := manager.store.SwapRefreshHash(sess.ID, oldHash, hash); err != nil {
+		return "", err
+	}
+	sess.RefreshHash = hash
+	return sess.Handle + "." + secret, nil
+}
+
+// RotateRefreshToken spends a refresh token and returns its session together
+// with the next token of the family.
+func (manager *SessionManager) RotateRefreshToken(refreshToken string) (*Session, string, error) {
+	handle, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || handle == "" || secret == "" {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	sess, err := manager.GetSessionByHandle(handle)
+	if errors.Is(err, ErrSessionNotFound) || errors.Is(err, ErrSessionExpired) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The swap fails when another request spent the same token first, even
+	// if this one read the session before that. Only a secret the session
+	// issued before counts as a replay; a wrong one leaves it alone.
+	next, err := manager.replaceRefreshToken(sess, hashRefreshSecret(secret))
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if err = manager.store.Delete(sess.ID); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrRefreshTokenReused
+	}
+	if errors.Is(err, ErrSessionNotFound) || errors.Is(err, ErrInvalidRefreshToken) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return sess, next, nil
+}
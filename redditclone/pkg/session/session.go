@@ -4,15 +4,30 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"time"
 )
 
+// Session is kept server-side under ID, the value of the HttpOnly cookie.
+// Handle names the session wherever scripts can read it, in access tokens,
+// refresh tokens and the session list, so none of them reveals the cookie.
 type Session struct {
-	ID       string
-	UserName string
-	UserID   string
+	ID        string
+	Handle    string
+	UserName  string
+	UserID    string
+	CreatedAt time.Time
+	LastSeen  time.Time
+	UserAgent string
+	IP        string
+	// RefreshHash is the SHA-256 of the current refresh token secret,
+	// SpentRefreshHashes those of the last secrets it replaced.
+	RefreshHash        string
+	SpentRefreshHashes []string
 }
 
-var SessionKey = "o1VeB8ndLVc0NQXN"
+type contextKey int
+
+const sessionKey contextKey = 0
 
 func GenerateHexID() (string, error) {
 	bytes := make([]byte, 8)
@@ -23,22 +38,40 @@ func GenerateHexID() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func NewSession(name, userID string) *Session {
+func generateHandle() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+func NewSession(name, userID, userAgent, ip string) *Session {
 	ID, err := GenerateHexID()
 	if err != nil {
 		return nil
 	}
+	handle, err := generateHandle()
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
 	return &Session{ID: ID,
-		UserName: name,
-		UserID:   userID}
+		Handle:    handle,
+		UserName:  name,
+		UserID:    userID,
+		CreatedAt: now,
+		LastSeen:  now,
+		UserAgent: userAgent,
+		IP:        ip}
 }
 
 func CreateContextWithSession(ctx context.Context, sess *Session) context.Context {
-	return context.WithValue(ctx, SessionKey, sess)
+	return context.WithValue(ctx, sessionKey, sess)
 }
 
 func GetSessionFromContext(ctx context.Context) (*Session, error) {
-	sess, ok := ctx.Value(SessionKey).(*Session)
+	sess, ok := ctx.Value(sessionKey).(*Session)
 	if !ok || sess == nil {
 		return nil, ErrSessionNotFound
 	}
@@ -0,0 +1,142 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// Store keeps sessions until their expiry. Implementations hand out copies,
+// so callers may modify the returned session and Save it back.
+type Store interface {
+	Save(sess *Session, expires time.Time) error
+	Get(id string) (*Session, error)
+	// GetByHandle finds a session by its public handle.
+	GetByHandle(handle string) (*Session, error)
+	// Touch records activity: it only stores the LastSeen of sess and moves
+	// the expiry, so it never undoes a concurrent change of the rest of the
+	// session. It never creates a session either and returns
+	// ErrSessionNotFound when the session was deleted meanwhile.
+	Touch(sess *Session, expires time.Time) error
+	// SwapRefreshHash replaces the refresh hash of a session only while it
+	// still equals oldHash, so each refresh token can be spent once even by
+	// concurrent requests. Otherwise it returns ErrRefreshTokenReused when
+	// oldHash was spent before and ErrInvalidRefreshToken when it is unknown.
+	SwapRefreshHash(id, oldHash, newHash string) error
+	Delete(id string) error
+	// List returns the live sessions of a user.
+	List(userID string) ([]*Session, error)
+	// Sweep drops sessions expired at now and returns how many were dropped.
+	Sweep(now time.Time) (int, error)
+}
+
+type memoryEntry struct {
+	sess    Session
+	expires time.Time
+}
+
+type MemoryStore struct {
+	data    map[string]*memoryEntry
+	handles map[string]string
+	mu      sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string]*memoryEntry), handles: make(map[string]string)}
+}
+
+func (store *MemoryStore) Save(sess *Session, expires time.Time) error {
+	store.mu.Lock()
+	store.data[sess.ID] = &memoryEntry{sess: *sess, expires: expires}
+	store.handles[sess.Handle] = sess.ID
+	store.mu.Unlock()
+	return nil
+}
+
+func (store *MemoryStore) Get(id string) (*Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.get(id)
+}
+
+func (store *MemoryStore) GetByHandle(handle string) (*Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	id, ok := store.handles[handle]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return store.get(id)
+}
+
+func (store *MemoryStore) get(id string) (*Session, error) {
+	entry, ok := store.data[id]
+	if !ok || !time.Now().Before(entry.expires) {
+		return nil, ErrSessionNotFound
+	}
+	sess := entry.sess
+	return &sess, nil
+}
+
+func (store *MemoryStore) Touch(sess *Session, expires time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entry, ok := store.data[sess.ID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	entry.sess.LastSeen = sess.LastSeen
+	entry.expires = expires
+	return nil
+}
+
+func (store *MemoryStore) SwapRefreshHash(id, oldHash, newHash string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entry, ok := store.data[id]
+	if !ok || !time.Now().Before(entry.expires) {
+		return ErrSessionNotFound
+	}
+	return swapRefreshHash(&entry.sess, oldHash, newHash)
+}
+
+func (store *MemoryStore) Delete(id string) error {
+	store.mu.Lock()
+	if entry, ok := store.data[id]; ok {
+		delete(store.handles, entry.sess.Handle)
+		delete(store.data, id)
+	}
+	store.mu.Unlock()
+	return nil
+}
+
+func (store *MemoryStore) List(userID string) ([]*Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	now := time.Now()
+	sessions := make([]*Session, 0)
+	for _, entry := range store.data {
+		if entry.sess.UserID == userID && now.Before(entry.expires) {
+			sess := entry.sess
+			sessions = append(sessions, &sess)
+		}
+	}
+	return sessions, nil
+}
+
+func (store *MemoryStore) Sweep(now time.Time) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	evicted := 0
+	for id, entry := range store.data {
+		if !now.Before(entry.expires) {
+			delete(store.handles, entry.sess.Handle)
+			delete(store.data, id)
+			evicted++
+		}
+	}
+	return evicted, nil
+}
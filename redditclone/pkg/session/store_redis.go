@@ -0,0 +1,259 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps sessions in any server speaking the Redis protocol and
+// relies on key expiry instead of sweeping. LastSeen lives in a key of its
+// own, so recording activity does not rewrite the session. Each user also
+// gets a set of their session ids, which lives as long as their latest
+// session and is pruned when listed or swept.
+type RedisStore struct {
+	client  redis.UniversalClient
+	prefix  string
+	timeout time.Duration
+}
+
+// swapRetries bounds how often SwapRefreshHash starts over when the session
+// changes between its read and its write.
+const swapRetries = 3
+
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix, timeout: 3 * time.Second}
+}
+
+func (store *RedisStore) key(id string) string {
+	return store.prefix + "session:" + id
+}
+
+func (store *RedisStore) handleKey(handle string) string {
+	return store.prefix + "session_handle:" + handle
+}
+
+func (store *RedisStore) lastSeenKey(id string) string {
+	return store.prefix + "last_seen:" + id
+}
+
+func (store *RedisStore) userKey(userID string) string {
+	return store.prefix + "user_sessions:" + userID
+}
+
+// expireUserSet keeps the user set alive at least until expires: NX gives a
+// set without expiry one, GT extends it when the session outlives the set.
+func (store *RedisStore) expireUserSet(ctx context.Context, pipe redis.Pipeliner, userID string, expires time.Time) {
+	ttl := time.Until(expires).Truncate(time.Second) + time.Second
+	pipe.ExpireNX(ctx, store.userKey(userID), ttl)
+	pipe.ExpireGT(ctx, store.userKey(userID), ttl)
+}
+
+func (store *RedisStore) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), store.timeout)
+}
+
+func (store *RedisStore) Save(sess *Session, expires time.Time) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := store.context()
+	defer cancel()
+	_, err = store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetArgs(ctx, store.key(sess.ID), data, redis.SetArgs{ExpireAt: expires})
+		pipe.SetArgs(ctx, store.lastSeenKey(sess.ID), sess.LastSeen.Format(time.RFC3339Nano),
+			redis.SetArgs{ExpireAt: expires})
+		pipe.SetArgs(ctx, store.handleKey(sess.Handle), sess.ID, redis.SetArgs{ExpireAt: expires})
+		pipe.SAdd(ctx, store.userKey(sess.UserID), sess.ID)
+		store.expireUserSet(ctx, pipe, sess.UserID, expires)
+		return nil
+	})
+	return err
+}
+
+func (store *RedisStore) get(ctx context.Context, id string) (*Session, error) {
+	values, err := store.client.MGet(ctx, store.key(id), store.lastSeenKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	data, ok := values[0].(string)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	sess := &Session{}
+	if err = json.Unmarshal([]byte(data), sess); err != nil {
+		return nil, err
+	}
+	if lastSeen, ok := values[1].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, lastSeen); err == nil {
+			sess.LastSeen = t
+		}
+	}
+	return sess, nil
+}
+
+func (store *RedisStore) Get(id string) (*Session, error) {
+	ctx, cancel := store.context()
+	defer cancel()
+	return store.get(ctx, id)
+}
+
+func (store *RedisStore) GetByHandle(handle string) (*Session, error) {
+	ctx, cancel := store.context()
+	defer cancel()
+
+	id, err := store.client.Get(ctx, store.handleKey(handle)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store.get(ctx, id)
+}
+
+func (store *RedisStore) Touch(sess *Session, expires time.Time) error {
+	ctx, cancel := store.context()
+	defer cancel()
+	// XX keeps a session deleted by a concurrent logout or revocation from
+	// coming back, and PEXPIREAT reports whether the session still exists.
+	var exists *redis.BoolCmd
+	_, err := store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetArgs(ctx, store.lastSeenKey(sess.ID), sess.LastSeen.Format(time.RFC3339Nano),
+			redis.SetArgs{Mode: "XX", ExpireAt: expires})
+		pipe.PExpireAt(ctx, store.handleKey(sess.Handle), expires)
+		store.expireUserSet(ctx, pipe, sess.UserID, expires)
+		exists = pipe.PExpireAt(ctx, store.key(sess.ID), expires)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	if !exists.Val() {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// SwapRefreshHash watches the session key, so the write only happens when
+// nothing else changed the session since it was read.
+func (store *RedisStore) SwapRefreshHash(id, oldHash, newHash string) error {
+	ctx, cancel := store.context()
+	defer cancel()
+
+	key := store.key(id)
+	swap := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		sess := &Session{}
+		if err = json.Unmarshal(data, sess); err != nil {
+			return err
+		}
+		if err = swapRefreshHash(sess, oldHash, newHash); err != nil {
+			return err
+		}
+		if data, err = json.Marshal(sess); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, data, redis.SetArgs{Mode: "XX", KeepTTL: true})
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < swapRetries; i++ {
+		if err = store.client.Watch(ctx, swap, key); !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return err
+}
+
+func (store *RedisStore) Delete(id string) error {
+	ctx, cancel := store.context()
+	defer cancel()
+
+	sess, err := store.get(ctx, id)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, store.key(id), store.lastSeenKey(id), store.handleKey(sess.Handle))
+		pipe.SRem(ctx, store.userKey(sess.UserID), id)
+		return nil
+	})
+	return err
+}
+
+// pruneUserSet drops the ids of expired sessions from the user set and
+// returns the live sessions.
+func (store *RedisStore) pruneUserSet(ctx context.Context, key string) ([]*Session, int, error) {
+	ids, err := store.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sessions := make([]*Session, 0, len(ids))
+	stale := make([]interface{}, 0)
+	for _, id := range ids {
+		sess, err := store.get(ctx, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			stale = append(stale, id)
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		sessions = append(sessions, sess)
+	}
+
+	if len(stale) > 0 {
+		if err = store.client.SRem(ctx, key, stale...).Err(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return sessions, len(stale), nil
+}
+
+func (store *RedisStore) List(userID string) ([]*Session, error) {
+	ctx, cancel := store.context()
+	defer cancel()
+	sessions, _, err := store.pruneUserSet(ctx, store.userKey(userID))
+	return sessions, err
+}
+
+// Sweep only prunes the user sets: every session key is written with the
+// expiry of its session, so Redis drops expired sessions itself. It returns
+// the number of stale ids removed.
+func (store *RedisStore) Sweep(now time.Time) (int, error) {
+	ctx, cancel := store.context()
+	defer cancel()
+
+	pruned := 0
+	iter := store.client.Scan(ctx, 0, store.userKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		_, n, err := store.pruneUserSet(ctx, iter.Val())
+		if err != nil {
+			return pruned, err
+		}
+		pruned += n
+	}
+	return pruned, iter.Err()
+}
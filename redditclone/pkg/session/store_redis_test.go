@@ -0,0 +1,280 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client, "test:"), mr
+}
+
+func saveTestSession(t *testing.T, store Store, userID string, expires time.Time) *Session {
+	t.Helper()
+	sess := NewSession("user-"+userID, userID, "test", "127.0.0.1")
+	if sess == nil {
+		t.Fatal("no session")
+	}
+	if err := store.Save(sess, expires); err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func userSessionIDs(t *testing.T, store *RedisStore, mr *miniredis.Miniredis, userID string) []string {
+	t.Helper()
+	if !mr.Exists(store.userKey(userID)) {
+		return nil
+	}
+	ids, err := mr.Members(store.userKey(userID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestRedisStoreSaveGetDelete(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	sess := saveTestSession(t, store, "u1", time.Now().Add(time.Hour))
+
+	got, err := store.Get(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != sess.ID || got.UserID != "u1" || got.UserName != "user-u1" || !got.LastSeen.Equal(sess.LastSeen) {
+		t.Errorf("got %+v, want %+v", got, sess)
+	}
+	if ids := userSessionIDs(t, store, mr, "u1"); len(ids) != 1 || ids[0] != sess.ID {
+		t.Errorf("user set = %v, want [%s]", ids, sess.ID)
+	}
+	if got, err = store.GetByHandle(sess.Handle); err != nil || got.ID != sess.ID {
+		t.Errorf("GetByHandle = %v, %v; want session %s", got, err, sess.ID)
+	}
+	if _, err = store.GetByHandle(sess.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetByHandle of the session id: err = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	if err = store.Delete(sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Get(sess.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Get after Delete: err = %v, want %v", err, ErrSessionNotFound)
+	}
+	if ids := userSessionIDs(t, store, mr, "u1"); len(ids) != 0 {
+		t.Errorf("user set after Delete = %v, want empty", ids)
+	}
+	if mr.Exists(store.lastSeenKey(sess.ID)) || mr.Exists(store.handleKey(sess.Handle)) {
+		t.Error("keys left after Delete")
+	}
+	if err = store.Delete(sess.ID); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+}
+
+func TestRedisStoreList(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	expires := time.Now().Add(time.Hour)
+	first := saveTestSession(t, store, "u1", expires)
+	second := saveTestSession(t, store, "u1", expires)
+	saveTestSession(t, store, "u2", expires)
+
+	sessions, err := store.List("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("List returned %d sessions, want 2", len(sessions))
+	}
+	for _, sess := range sessions {
+		if sess.ID != first.ID && sess.ID != second.ID {
+			t.Errorf("List returned session %s of another user", sess.ID)
+		}
+	}
+
+	mr.Del(store.key(first.ID))
+	if sessions, err = store.List("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != second.ID {
+		t.Errorf("List after removal = %v, want only %s", sessions, second.ID)
+	}
+	if ids := userSessionIDs(t, store, mr, "u1"); len(ids) != 1 || ids[0] != second.ID {
+		t.Errorf("user set = %v, want the stale id pruned", ids)
+	}
+}
+
+func TestRedisStoreExpiry(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	sess := saveTestSession(t, store, "u1", time.Now().Add(time.Minute))
+
+	mr.FastForward(30 * time.Second)
+	if _, err := store.Get(sess.ID); err != nil {
+		t.Fatalf("Get before expiry: %v", err)
+	}
+
+	mr.FastForward(time.Minute)
+	if _, err := store.Get(sess.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Get after expiry: err = %v, want %v", err, ErrSessionNotFound)
+	}
+	sessions, err := store.List("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("List after expiry returned %d sessions", len(sessions))
+	}
+	if ids := userSessionIDs(t, store, mr, "u1"); len(ids) != 0 {
+		t.Errorf("user set after expiry = %v, want empty", ids)
+	}
+	if n, err := store.Sweep(time.Now()); n != 0 || err != nil {
+		t.Errorf("Sweep = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestRedisStoreUserSetExpiry(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	saveTestSession(t, store, "u1", time.Now().Add(time.Minute))
+	if ttl := mr.TTL(store.userKey("u1")); ttl <= 0 || ttl > 2*time.Minute {
+		t.Errorf("user set TTL = %v, want about a minute", ttl)
+	}
+	long := saveTestSession(t, store, "u1", time.Now().Add(time.Hour))
+	saveTestSession(t, store, "u1", time.Now().Add(2*time.Minute))
+	if ttl := mr.TTL(store.userKey("u1")); ttl < 59*time.Minute {
+		t.Errorf("user set TTL = %v, want it to last as long as the latest session", ttl)
+	}
+
+	mr.FastForward(5 * time.Minute)
+	if n, err := store.Sweep(time.Now()); n != 2 || err != nil {
+		t.Errorf("Sweep = %d, %v; want 2, nil", n, err)
+	}
+	if ids := userSessionIDs(t, store, mr, "u1"); len(ids) != 1 || ids[0] != long.ID {
+		t.Errorf("user set after Sweep = %v, want only %s", ids, long.ID)
+	}
+
+	mr.FastForward(time.Hour)
+	if mr.Exists(store.userKey("u1")) {
+		t.Error("user set outlived all its sessions")
+	}
+}
+
+func TestRedisStoreTouch(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	sess := saveTestSession(t, store, "u1", time.Now().Add(time.Minute))
+
+	lastSeen := sess.LastSeen.Add(time.Minute)
+	sess.LastSeen = lastSeen
+	if err := store.Touch(sess, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.LastSeen.Equal(lastSeen) {
+		t.Errorf("LastSeen = %v, want %v", got.LastSeen, lastSeen)
+	}
+	mr.FastForward(30 * time.Minute)
+	if _, err = store.GetByHandle(sess.Handle); err != nil {
+		t.Errorf("Touch did not extend the expiry: %v", err)
+	}
+
+	if err = store.Delete(sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Touch(sess, time.Now().Add(time.Hour)); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Touch after Delete: err = %v, want %v", err, ErrSessionNotFound)
+	}
+	if mr.Exists(store.key(sess.ID)) || mr.Exists(store.lastSeenKey(sess.ID)) || mr.Exists(store.handleKey(sess.Handle)) {
+		t.Error("Touch recreated a deleted session")
+	}
+}
+
+func TestRedisStoreSwapRefreshHash(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	sess := saveTestSession(t, store, "u1", time.Now().Add(time.Hour))
+
+	if err := store.SwapRefreshHash(sess.ID, "", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SwapRefreshHash(sess.ID, "first", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SwapRefreshHash(sess.ID, "first", "third"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("swap of a spent hash: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if err := store.SwapRefreshHash(sess.ID, "never issued", "third"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("swap of an unknown hash: err = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	got, err := store.Get(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RefreshHash != "second" {
+		t.Errorf("RefreshHash = %q, want %q", got.RefreshHash, "second")
+	}
+	if ttl := mr.TTL(store.key(sess.ID)); ttl <= 0 {
+		t.Errorf("swap dropped the expiry, ttl = %v", ttl)
+	}
+	if err = store.SwapRefreshHash("missing", "", "x"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("swap of a missing session: err = %v, want %v", err, ErrSessionNotFound)
+	}
+}
+
+func TestRedisStoreDestroyAllSessions(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	manager := NewSessionsManager(store, DefaultConfig)
+	saveTestSession(t, store, "u1", time.Now().Add(time.Hour))
+	saveTestSession(t, store, "u1", time.Now().Add(time.Hour))
+	other := saveTestSession(t, store, "u2", time.Now().Add(time.Hour))
+
+	n, err := manager.DestroyAllSessions("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("DestroyAllSessions = %d, want 2", n)
+	}
+	if ids := userSessionIDs(t, store, mr, "u1"); len(ids) != 0 {
+		t.Errorf("user set after DestroyAllSessions = %v, want empty", ids)
+	}
+	if _, err = store.Get(other.ID); err != nil {
+		t.Errorf("session of another user: %v", err)
+	}
+}
+
+func TestRedisStoreRotateRefreshToken(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	manager := NewSessionsManager(store, DefaultConfig)
+	sess := saveTestSession(t, store, "u1", time.Now().Add(time.Hour))
+
+	first, err := manager.IssueRefreshToken(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = manager.RotateRefreshToken(sess.Handle + ".guessed"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown secret: err = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if _, _, err = manager.RotateRefreshToken(first); err != nil {
+		t.Fatalf("a wrong secret ended the session: %v", err)
+	}
+	if _, _, err = manager.RotateRefreshToken(first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("replayed token: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if _, err = store.Get(sess.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("session left after a replay: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Claims of an access token. SessionHandle is the public handle of the
+// session, never its id, which is the value of the HttpOnly cookie.
+type Claims struct {
+	UserName      string
+	UserID        string
+	SessionHandle string
+}
+
+type Manager struct {
+	keys   map[string]*Key
+	active *Key
+	ttl    time.Duration
+}
+
+var ErrInvalidToken = errors.New("invalid token")
+var ErrTokenExpired = errors.New("token expired")
+
+func NewManager(active string, keys []*Key, ttl time.Duration) (*Manager, error) {
+	m := &Manager{keys: make(map[string]*Key, len(keys)), ttl: ttl}
+	for _, key := range keys {
+		if _, ok := m.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		m.keys[key.ID] = key
+	}
+
+	key, ok := m.keys[active]
+	if !ok || !key.CanSign() {
+		return nil, ErrNoSigningKey
+	}
+	m.active = key
+	return m, nil
+}
+
+// Create issues a token bound to a server-side session, so destroying the
+// session revokes the token.
+func (m *Manager) Create(userName, userID, sessionHandle string, now time.Time) (string, error) {
+	token := jwt.NewWithClaims(m.active.Method, jwt.MapClaims{
+		"user": map[string]string{"username": userName, "id": userID},
+		"sid":  sessionHandle,
+		"iat":  now.Unix(),
+		"exp":  now.Add(m.ttl).Unix(),
+	})
+	token.Header["kid"] = m.active.ID
+
+	return token.SignedString(m.active.signKey)
+}
+
+// Tokens issued before keys got ids carry no kid header and are checked
+// against the active key.
+func (m *Manager) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := m.active
+	if kid, ok := token.Header["kid"]; ok {
+		id, _ := kid.(string)
+		if key, ok = m.keys[id]; !ok {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+func (m *Manager) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0)}
+	for _, key := range m.keys {
+		if jwk, ok := key.jwk(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+	return jwks
+}
+
+func (m *Manager) Parse(tokenString string) (*Claims, error) {
+	mapClaims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, mapClaims, m.keyFunc)
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		// An expired token is only reported as such when nothing else is
+		// wrong with it; a forged one must not pass for merely expired.
+		if errors.As(err, &validationErr) && validationErr.Errors == jwt.ValidationErrorExpired {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now().Unix()
+	if !mapClaims.VerifyExpiresAt(now, true) {
+		return nil, ErrTokenExpired
+	}
+	if !mapClaims.VerifyIssuedAt(now, true) {
+		return nil, ErrInvalidToken
+	}
+
+	user, ok := mapClaims["user"].(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	claims := &Claims{}
+	claims.UserName, _ = user["username"].(string)
+	claims.UserID, _ = user["id"].(string)
+	claims.SessionHandle, _ = mapClaims["sid"].(string)
+	if claims.UserName == "" || claims.UserID == "" || claims.SessionHandle == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,156 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+var ErrNoSigningKey = errors.New("no signing key")
+var ErrUnknownKey = errors.New("unknown key id")
+
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// NewRSAKey creates an RS256 key. A nil private key gives a verify-only key,
+// which is how retired keys of other issuers are kept around.
+func NewRSAKey(id string, private *rsa.PrivateKey, public *rsa.PublicKey) *Key {
+	key := &Key{ID: id, Method: jwt.SigningMethodRS256, verifyKey: public}
+	if private != nil {
+		key.signKey = private
+		key.verifyKey = &private.PublicKey
+	}
+	return key
+}
+
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+type KeyConfig struct {
+	ID             string `json:"kid"`
+	Alg            string `json:"alg"`
+	Secret         string `json:"secret,omitempty"`
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	PublicKeyFile  string `json:"public_key_file,omitempty"`
+}
+
+// KeysConfig is the format of the -jwt-keys file. Active is the kid new
+// tokens are signed with; the other keys are only used for verification.
+type KeysConfig struct {
+	Active string      `json:"active"`
+	Keys   []KeyConfig `json:"keys"`
+}
+
+func readKeyFile(dir, name string) ([]byte, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	return os.ReadFile(name)
+}
+
+func (kc KeyConfig) load(dir string) (*Key, error) {
+	switch kc.Alg {
+	case "HS256":
+		if kc.Secret == "" {
+			return nil, fmt.Errorf("key %q: empty secret", kc.ID)
+		}
+		return NewHMACKey(kc.ID, []byte(kc.Secret)), nil
+	case "RS256":
+		if kc.PrivateKeyFile != "" {
+			pem, err := readKeyFile(dir, kc.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", kc.ID, err)
+			}
+			return NewRSAKey(kc.ID, private, nil), nil
+		}
+		pem, err := readKeyFile(dir, kc.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kc.ID, err)
+		}
+		return NewRSAKey(kc.ID, nil, public), nil
+	default:
+		return nil, fmt.Errorf("key %q: unsupported alg %q", kc.ID, kc.Alg)
+	}
+}
+
+func LoadKeys(path string) (active string, keys []*Key, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	config := KeysConfig{}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return "", nil, err
+	}
+
+	for _, kc := range config.Keys {
+		key, err := kc.load(filepath.Dir(path))
+		if err != nil {
+			return "", nil, err
+		}
+		keys = append(keys, key)
+	}
+	return config.Active, keys, nil
+}
+
+func GenerateHMACKey(id string) (*Key, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return NewHMACKey(id, secret), nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *Key) jwk() (JWK, bool) {
+	public, ok := k.verifyKey.(*rsa.PublicKey)
+	if !ok {
+		return JWK{}, false
+	}
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: k.Method.Alg(),
+		Kid: k.ID,
+		N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+	}, true
+}
@@ -0,0 +1,199 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher hashes passwords into a self-describing string, so that the stored
+// value carries the algorithm and its parameters.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (bool, error)
+	// NeedsRehash reports whether encoded was produced with other parameters
+	// than the ones the hasher currently uses.
+	NeedsRehash(encoded string) bool
+	// Supports reports whether encoded was produced by this hasher.
+	Supports(encoded string) bool
+}
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{Cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+func (h *BcryptHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+// Argon2idHasher encodes hashes in the PHC string format:
+// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{Time: 1, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+}
+
+const argon2idPrefix = "$argon2id$"
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+type argon2idParams struct {
+	version int
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h *Argon2idHasher) decode(encoded string) (*argon2idParams, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownHash
+	}
+
+	p := &argon2idParams{}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &p.version); err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	p, err := h.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	if p.version != argon2.Version {
+		return false, ErrUnknownHash
+	}
+
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return p.version != argon2.Version || p.memory != h.Memory || p.time != h.Time ||
+		p.threads != h.Threads || uint32(len(p.key)) != h.KeyLen || uint32(len(p.salt)) != h.SaltLen
+}
+
+func (h *Argon2idHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+// PasswordHasher hashes new passwords with Preferred and verifies hashes
+// produced by any of the Legacy hashers. Values no hasher recognises are
+// refused with ErrUnknownHash: passwords left in plaintext from before they
+// were hashed have to be migrated first.
+type PasswordHasher struct {
+	Preferred Hasher
+	Legacy    []Hasher
+}
+
+func NewPasswordHasher(preferred Hasher, legacy ...Hasher) *PasswordHasher {
+	return &PasswordHasher{Preferred: preferred, Legacy: legacy}
+}
+
+func (h *PasswordHasher) hasherFor(encoded string) Hasher {
+	if h.Preferred.Supports(encoded) {
+		return h.Preferred
+	}
+	for _, legacy := range h.Legacy {
+		if legacy.Supports(encoded) {
+			return legacy
+		}
+	}
+	return nil
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.Preferred.Hash(password)
+}
+
+func (h *PasswordHasher) Verify(encoded, password string) (bool, error) {
+	hasher := h.hasherFor(encoded)
+	if hasher == nil {
+		return false, ErrUnknownHash
+	}
+	return hasher.Verify(encoded, password)
+}
+
+func (h *PasswordHasher) NeedsRehash(encoded string) bool {
+	return !h.Preferred.Supports(encoded) || h.Preferred.NeedsRehash(encoded)
+}
+
+func (h *PasswordHasher) Supports(encoded string) bool {
+	return h.hasherFor(encoded) != nil
+}
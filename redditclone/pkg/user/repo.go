@@ -2,52 +2,177 @@ package user
 
 import (
 	"errors"
+	"sort"
 	"sync"
 )
 
 type UserMemoryRepository struct {
-	data map[string]*User
-	mu   sync.RWMutex
+	data   map[string]*User
+	mu     sync.RWMutex
+	hasher Hasher
 }
 
 var ErrUserAlready = errors.New("already exist")
 var ErrUserNotExist = errors.New("user not found")
 var ErrInvalidPassword = errors.New("invalid password")
+var ErrNotModerator = errors.New("user is not a moderator of the community")
 
-func NewUserMemRep() *UserMemoryRepository {
-	return &UserMemoryRepository{data: make(map[string]*User)}
+func NewUserMemRep(hasher Hasher) *UserMemoryRepository {
+	return &UserMemoryRepository{data: make(map[string]*User), hasher: hasher}
+}
+
+// clone returns a copy of u, so callers can read it while SetRole and the
+// moderator changes update the stored user.
+func clone(u *User) *User {
+	copied := *u
+	if u.Moderates != nil {
+		copied.Moderates = make([]string, len(u.Moderates))
+		copy(copied.Moderates, u.Moderates)
+	}
+	return &copied
 }
 
 func (repo *UserMemoryRepository) CheckUser(name, password string) error {
-	if _, ok := repo.data[name]; !ok {
+	repo.mu.RLock()
+	val, ok := repo.data[name]
+	var stored string
+	if ok {
+		stored = val.Password
+	}
+	repo.mu.RUnlock()
+	if !ok {
 		return ErrUserNotExist
 	}
 
-	if val, ok := repo.data[name]; ok && val.Password != password {
+	valid, err := repo.hasher.Verify(stored, password)
+	if err != nil {
+		return err
+	}
+	if !valid {
 		return ErrInvalidPassword
 	}
 
-	return nil
+	if repo.hasher.NeedsRehash(stored) {
+		hash, err := repo.hasher.Hash(password)
+		if err != nil {
+			return err
+		}
+		// skip the upgrade if another login has rehashed it meanwhile
+		repo.mu.Lock()
+		if val.Password == stored {
+			val.Password = hash
+		}
+		repo.mu.Unlock()
+	}
 
+	return nil
 }
 
 func (repo *UserMemoryRepository) AddUser(user *User) error {
-	if repo.CheckUser(user.Name, user.Password) != nil {
-
-		repo.mu.Lock()
-		repo.data[user.Name] = user
-		repo.mu.Unlock()
+	hash, err := repo.hasher.Hash(user.Password)
+	if err != nil {
+		return err
+	}
 
-		return nil
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if _, ok := repo.data[user.Name]; ok {
+		return ErrUserAlready
 	}
 
-	return ErrUserAlready
+	stored := clone(user)
+	stored.Password = hash
+	if stored.Role == "" {
+		stored.Role = RoleUser
+	}
+	repo.data[user.Name] = stored
 
+	return nil
 }
 
 func (repo *UserMemoryRepository) GetUser(name string) (*User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
 	if val, ok := repo.data[name]; ok {
-		return val, nil
+		return clone(val), nil
 	}
 	return nil, ErrUserNotExist
 }
+
+func (repo *UserMemoryRepository) GetUserByID(id string) (*User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	u, err := repo.findByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return clone(u), nil
+}
+
+func (repo *UserMemoryRepository) findByID(id string) (*User, error) {
+	for _, val := range repo.data {
+		if val.ID == id {
+			return val, nil
+		}
+	}
+	return nil, ErrUserNotExist
+}
+
+func (repo *UserMemoryRepository) SetRole(userID, role string) error {
+	if !IsRole(role) {
+		return ErrUnknownRole
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	u, err := repo.findByID(userID)
+	if err != nil {
+		return err
+	}
+	u.Role = role
+	return nil
+}
+
+func (repo *UserMemoryRepository) AddModerator(userID, community string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	u, err := repo.findByID(userID)
+	if err != nil {
+		return err
+	}
+	if !u.IsModerator(community) {
+		u.Moderates = append(u.Moderates, community)
+	}
+	return nil
+}
+
+func (repo *UserMemoryRepository) DeleteModerator(userID, community string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	u, err := repo.findByID(userID)
+	if err != nil {
+		return err
+	}
+	for i, c := range u.Moderates {
+		if c == community {
+			u.Moderates = append(u.Moderates[:i], u.Moderates[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotModerator
+}
+
+func (repo *UserMemoryRepository) GetModerators(community string) ([]*User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	moderators := make([]*User, 0)
+	for _, val := range repo.data {
+		if val.IsModerator(community) {
+			moderators = append(moderators, clone(val))
+		}
+	}
+	sort.Slice(moderators, func(i, j int) bool {
+		return moderators[i].Name < moderators[j].Name
+	})
+	return moderators, nil
+}
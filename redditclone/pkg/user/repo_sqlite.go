@@ -0,0 +1,253 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+)
+
+type UserSQLiteRepository struct {
+	db     *sql.DB
+	hasher Hasher
+}
+
+var usersSchema = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id       TEXT PRIMARY KEY,
+		name     TEXT NOT NULL,
+		password TEXT NOT NULL,
+		role     TEXT NOT NULL DEFAULT 'user',
+		created  TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS users_name_idx ON users (name)`,
+	`CREATE TABLE IF NOT EXISTS user_moderators (
+		user_id   TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		community TEXT NOT NULL,
+		PRIMARY KEY (user_id, community)
+	)`,
+	`CREATE INDEX IF NOT EXISTS user_moderators_community_idx ON user_moderators (community)`,
+}
+
+const userColumns = `id, name, password, role, created`
+
+func NewUserSQLiteRepository(db *sql.DB, hasher Hasher) (*UserSQLiteRepository, error) {
+	for _, stmt := range usersSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	// Databases created before roles and registration times lack their
+	// columns; accounts without a registration time count as old.
+	for _, m := range []struct{ column, definition string }{
+		{"role", "TEXT NOT NULL DEFAULT 'user'"},
+		{"created", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		var ok bool
+		err := db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info('users') WHERE name = ?`, m.column).Scan(&ok)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			continue
+		}
+		if _, err = db.Exec(`ALTER TABLE users ADD COLUMN ` + m.column + ` ` + m.definition); err != nil {
+			return nil, err
+		}
+	}
+	return &UserSQLiteRepository{db: db, hasher: hasher}, nil
+}
+
+func (repo *UserSQLiteRepository) queryUser(query string, arg string) (*User, error) {
+	u := &User{}
+	err := repo.db.QueryRow(query, arg).Scan(&u.ID, &u.Name, &u.Password, &u.Role, &u.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = repo.loadModerates(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (repo *UserSQLiteRepository) loadModerates(u *User) error {
+	rows, err := repo.db.Query(`SELECT community FROM user_moderators WHERE user_id = ? ORDER BY rowid`, u.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var community string
+		if err = rows.Scan(&community); err != nil {
+			return err
+		}
+		u.Moderates = append(u.Moderates, community)
+	}
+	return rows.Err()
+}
+
+func (repo *UserSQLiteRepository) CheckUser(name, password string) error {
+	u, err := repo.GetUser(name)
+	if err != nil {
+		return err
+	}
+
+	valid, err := repo.hasher.Verify(u.Password, password)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrInvalidPassword
+	}
+
+	if repo.hasher.NeedsRehash(u.Password) {
+		hash, err := repo.hasher.Hash(password)
+		if err != nil {
+			return err
+		}
+		_, err = repo.db.Exec(`UPDATE users SET password = ? WHERE id = ?`, hash, u.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HashPlaintextPasswords hashes the passwords the hasher does not
+// recognise, which are taken for plaintext stored before passwords were
+// hashed. It is meant to run once on such a database.
+func (repo *UserSQLiteRepository) HashPlaintextPasswords() error {
+	rows, err := repo.db.Query(`SELECT id, password FROM users`)
+	if err != nil {
+		return err
+	}
+	plaintext := make(map[string]string)
+	for rows.Next() {
+		var id, password string
+		if err = rows.Scan(&id, &password); err != nil {
+			rows.Close()
+			return err
+		}
+		if !repo.hasher.Supports(password) {
+			plaintext[id] = password
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for id, password := range plaintext {
+		hash, err := repo.hasher.Hash(password)
+		if err != nil {
+			return err
+		}
+		if _, err = repo.db.Exec(`UPDATE users SET password = ? WHERE id = ?`, hash, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repo *UserSQLiteRepository) AddUser(user *User) error {
+	hash, err := repo.hasher.Hash(user.Password)
+	if err != nil {
+		return err
+	}
+
+	role := user.Role
+	if role == "" {
+		role = RoleUser
+	}
+
+	res, err := repo.db.Exec(`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO NOTHING`, user.ID, user.Name, hash, role, user.Created)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserAlready
+	}
+	return nil
+}
+
+func (repo *UserSQLiteRepository) GetUser(name string) (*User, error) {
+	return repo.queryUser(`SELECT `+userColumns+` FROM users WHERE name = ?`, name)
+}
+
+func (repo *UserSQLiteRepository) GetUserByID(id string) (*User, error) {
+	return repo.queryUser(`SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+// execOnUser runs a statement about an existing user.
+func (repo *UserSQLiteRepository) execOnUser(userID, query string, args ...any) (sql.Result, error) {
+	if _, err := repo.GetUserByID(userID); err != nil {
+		return nil, err
+	}
+	return repo.db.Exec(query, args...)
+}
+
+func (repo *UserSQLiteRepository) SetRole(userID, role string) error {
+	if !IsRole(role) {
+		return ErrUnknownRole
+	}
+	_, err := repo.execOnUser(userID, `UPDATE users SET role = ? WHERE id = ?`, role, userID)
+	return err
+}
+
+func (repo *UserSQLiteRepository) AddModerator(userID, community string) error {
+	_, err := repo.execOnUser(userID, `INSERT INTO user_moderators (user_id, community) VALUES (?, ?)
+		ON CONFLICT (user_id, community) DO NOTHING`, userID, community)
+	return err
+}
+
+func (repo *UserSQLiteRepository) DeleteModerator(userID, community string) error {
+	res, err := repo.execOnUser(userID, `DELETE FROM user_moderators WHERE user_id = ? AND community = ?`, userID, community)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotModerator
+	}
+	return nil
+}
+
+func (repo *UserSQLiteRepository) GetModerators(community string) ([]*User, error) {
+	rows, err := repo.db.Query(`SELECT u.id, u.name, u.password, u.role, u.created FROM users u
+		JOIN user_moderators m ON m.user_id = u.id WHERE m.community = ? ORDER BY u.name`, community)
+	if err != nil {
+		return nil, err
+	}
+
+	moderators := make([]*User, 0)
+	for rows.Next() {
+		u := &User{}
+		if err = rows.Scan(&u.ID, &u.Name, &u.Password, &u.Role, &u.Created); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		moderators = append(moderators, u)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, u := range moderators {
+		if err = repo.loadModerates(u); err != nil {
+			return nil, err
+		}
+	}
+	return moderators, nil
+}
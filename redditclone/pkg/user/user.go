@@ -1,13 +1,50 @@
 package user
 
+import "errors"
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// User is an account. Role is the site wide role; Moderates lists the
+// communities the user moderates. Created is the registration time, empty
+// for accounts registered before it was kept.
 type User struct {
-	Name     string
-	Password string
-	ID       string
+	Name      string
+	Password  string
+	ID        string
+	Role      string
+	Moderates []string
+	Created   string
 }
 
 type UserRepo interface {
 	CheckUser(name, password string) error
 	AddUser(user *User) error
 	GetUser(name string) (*User, error)
+	GetUserByID(id string) (*User, error)
+	SetRole(userID, role string) error
+	AddModerator(userID, community string) error
+	DeleteModerator(userID, community string) error
+	GetModerators(community string) ([]*User, error)
+}
+
+func IsRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+func (u *User) IsModerator(community string) bool {
+	for _, c := range u.Moderates {
+		if c == community {
+			return true
+		}
+	}
+	return false
 }
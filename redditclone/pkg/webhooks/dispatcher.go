@@ -0,0 +1,425 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"redditclone/pkg/events"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Defaults of a dispatcher: with 6 attempts from 30s doubling, the last
+// retry comes about half an hour after the event.
+const (
+	DefaultMaxAttempts  = 6
+	DefaultDisableAfter = 10
+	DefaultBaseDelay    = 30 * time.Second
+	DefaultMaxDelay     = time.Hour
+	DefaultTimeout      = 10 * time.Second
+	DefaultWorkers      = 4
+	DefaultPollInterval = 5 * time.Second
+	maxRedirects        = 10
+)
+
+// Dispatcher turns the community events of the bus into deliveries and
+// sends them. A failed attempt, a network error or an answer other than
+// 2xx, is retried after BaseDelay doubled with each attempt up to MaxDelay;
+// after MaxAttempts the delivery is dead. After DisableAfter dead deliveries
+// in a row the webhook is disabled: it gets no new deliveries and its
+// pending ones die without being sent.
+//
+// Events only write pending deliveries to the repository. A scheduler hands
+// the due ones to the workers as they have room, so a slow receiver delays
+// deliveries instead of holding up the writers or losing events.
+type Dispatcher struct {
+	Repo        Repo
+	Client      *http.Client
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// DisableAfter of zero never disables a webhook.
+	DisableAfter int
+	// PollInterval is the longest the scheduler waits before looking for
+	// due deliveries again.
+	PollInterval time.Duration
+	Logger       *zap.SugaredLogger
+
+	queue   chan *Delivery
+	wake    chan struct{}
+	stop    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+	sub     *events.Subscription
+	claimed map[string]bool
+	mu      sync.Mutex
+}
+
+func NewDispatcher(repo Repo, logger *zap.SugaredLogger) *Dispatcher {
+	return &Dispatcher{
+		Repo:         repo,
+		Client:       NewClient(),
+		MaxAttempts:  DefaultMaxAttempts,
+		BaseDelay:    DefaultBaseDelay,
+		MaxDelay:     DefaultMaxDelay,
+		DisableAfter: DefaultDisableAfter,
+		PollInterval: DefaultPollInterval,
+		Logger:       logger,
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+		claimed:      make(map[string]bool),
+	}
+}
+
+// NewClient returns the client deliveries are sent with. It only connects
+// to public addresses: the check runs on the resolved address of every
+// connection, so neither a host name pointing inside nor a redirect reaches
+// the server's own network. Going through a proxy would defeat it, so none
+// is used.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{Timeout: DefaultTimeout, Control: checkDialAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: DefaultTimeout, Transport: transport, CheckRedirect: checkRedirect}
+}
+
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// checkRedirect holds redirects to the rules of registered URLs.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if err := CheckURL(req.URL.String()); err != nil {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// Start subscribes to the bus and starts the workers and the scheduler,
+// which first picks up the deliveries that were still pending when the
+// server stopped.
+func (d *Dispatcher) Start(bus *events.Bus, workers int) error {
+	d.queue = make(chan *Delivery, workers)
+	next, err := d.dispatchDue()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	d.wg.Add(1)
+	go d.schedule(next)
+
+	// Writing the pending deliveries is quick, so it happens right in the
+	// publisher and no event is ever dropped.
+	d.sub = bus.Subscribe("webhooks", d.handleEvent, events.Options{
+		Names: []string{events.NamePostCreated, events.NamePostEdited, events.NamePostDeleted,
+			events.NameCommentAdded, events.NameCommentDeleted, events.NameVoteCast},
+		Delivery: events.Sync,
+	})
+	return nil
+}
+
+// Stop lets the workers finish the attempts in progress. Deliveries not
+// attempted yet stay pending in the repository.
+func (d *Dispatcher) Stop() {
+	if d.sub != nil {
+		d.sub.Close()
+	}
+	d.once.Do(func() { close(d.stop) })
+	d.wg.Wait()
+}
+
+// Redeliver sends a delivered or dead delivery again with a fresh set of
+// attempts, unless its webhook is disabled.
+func (d *Dispatcher) Redeliver(del *Delivery) error {
+	if del.Status == StatusPending {
+		return ErrDeliveryPending
+	}
+	hook, err := d.Repo.GetWebhook(del.Community, del.WebhookID)
+	if err != nil {
+		return err
+	}
+	if hook.Disabled {
+		return ErrWebhookDisabled
+	}
+	del.Status, del.Attempts, del.Error, del.NextAttempt = StatusPending, 0, "", ""
+	if err := d.Repo.SaveDelivery(del); err != nil {
+		return err
+	}
+	d.notify()
+	return nil
+}
+
+// handleEvent records a delivery for each enabled webhook of the community
+// that wants the event.
+func (d *Dispatcher) handleEvent(e events.Event) {
+	name, community, data, ok := communityEvent(e)
+	if !ok {
+		return
+	}
+	hooks, err := d.Repo.GetWebhooks(community)
+	if err != nil {
+		d.Logger.Error(err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if hook.Disabled || !hook.Wants(name) {
+			continue
+		}
+		id, err := newID()
+		if err != nil {
+			d.Logger.Error(err)
+			return
+		}
+		created := now()
+		payload, err := json.Marshal(Payload{ID: id, Event: name, Community: community, Created: created, Data: data})
+		if err != nil {
+			d.Logger.Error(err)
+			return
+		}
+
+		del := &Delivery{ID: id, WebhookID: hook.ID, Community: community, Event: name, Payload: payload,
+			Status: StatusPending, Created: created}
+		if err = d.Repo.SaveDelivery(del); err != nil {
+			d.Logger.Error(err)
+			continue
+		}
+	}
+	d.notify()
+}
+
+// notify wakes the scheduler up; wake-ups coming while it is busy are
+// merged into one.
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule hands the due deliveries to the workers whenever it is woken
+// up, a retry comes due or PollInterval passes.
+func (d *Dispatcher) schedule(next time.Duration) {
+	defer d.wg.Done()
+	timer := time.NewTimer(next)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-d.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+		}
+
+		next, err := d.dispatchDue()
+		if err != nil {
+			d.Logger.Error(err)
+		}
+		timer.Reset(next)
+	}
+}
+
+// dispatchDue queues the due pending deliveries no worker has yet, as long
+// as the workers have room, and returns when the next one comes due.
+func (d *Dispatcher) dispatchDue() (time.Duration, error) {
+	next := d.PollInterval
+	pending, err := d.Repo.GetPendingDeliveries()
+	if err != nil {
+		return next, err
+	}
+
+	current := time.Now()
+	for _, del := range pending {
+		if del.NextAttempt != "" {
+			at, err := time.Parse(time.RFC3339Nano, del.NextAttempt)
+			if err == nil && at.After(current) {
+				if wait := at.Sub(current); wait < next {
+					next = wait
+				}
+				continue
+			}
+		}
+		if !d.claim(del.ID) {
+			continue
+		}
+		select {
+		case d.queue <- del:
+		default:
+			// the workers are busy; they wake the scheduler up when done
+			d.release(del.ID)
+			return next, nil
+		}
+	}
+	return next, nil
+}
+
+func (d *Dispatcher) claim(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.claimed[id] {
+		return false
+	}
+	d.claimed[id] = true
+	return true
+}
+
+func (d *Dispatcher) release(id string) {
+	d.mu.Lock()
+	delete(d.claimed, id)
+	d.mu.Unlock()
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case del := <-d.queue:
+			d.attempt(del)
+			d.release(del.ID)
+			d.notify()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(del *Delivery) {
+	hook, err := d.Repo.GetWebhook(del.Community, del.WebhookID)
+	if errors.Is(err, ErrWebhookNotFound) {
+		// the webhook was deleted together with its deliveries
+		return
+	}
+
+	if err == nil && hook.Disabled {
+		// the delivery was pending when the webhook was disabled
+		del.Status, del.Error, del.NextAttempt = StatusDead, ErrWebhookDisabled.Error(), ""
+		if err = d.Repo.SaveDelivery(del); err != nil {
+			d.Logger.Error(err)
+		}
+		return
+	}
+
+	del.Attempts++
+	del.LastAttempt = now()
+	if err != nil {
+		d.Logger.Error(err)
+		d.retry(del, err)
+		return
+	}
+	del.ResponseStatus, err = d.send(hook, del)
+	if err != nil {
+		d.retry(del, err)
+		return
+	}
+
+	del.Status, del.Error, del.NextAttempt = StatusDelivered, "", ""
+	if err = d.Repo.SaveDelivery(del); err != nil {
+		d.Logger.Error(err)
+	}
+	_, err = d.Repo.RecordResult(del.Community, del.WebhookID, false, d.DisableAfter)
+	if err != nil && !errors.Is(err, ErrWebhookNotFound) {
+		d.Logger.Error(err)
+	}
+}
+
+// retry schedules the next attempt after a failure or declares the
+// delivery dead.
+func (d *Dispatcher) retry(del *Delivery, cause error) {
+	del.Error = cause.Error()
+	if del.Attempts >= d.MaxAttempts {
+		del.Status, del.NextAttempt = StatusDead, ""
+		d.Logger.Warnw("webhook delivery failed for good",
+			"webhook", del.WebhookID, "delivery", del.ID, "attempts", del.Attempts, "error", del.Error)
+		if err := d.Repo.SaveDelivery(del); err != nil {
+			d.Logger.Error(err)
+		}
+		d.recordDead(del)
+		return
+	}
+
+	del.NextAttempt = time.Now().UTC().Add(d.backoff(del.Attempts)).Format(time.RFC3339Nano)
+	if err := d.Repo.SaveDelivery(del); err != nil {
+		d.Logger.Error(err)
+	}
+}
+
+// recordDead counts the dead delivery against its webhook, which may
+// disable it.
+func (d *Dispatcher) recordDead(del *Delivery) {
+	disabled, err := d.Repo.RecordResult(del.Community, del.WebhookID, true, d.DisableAfter)
+	if errors.Is(err, ErrWebhookNotFound) {
+		return
+	}
+	if err != nil {
+		d.Logger.Error(err)
+		return
+	}
+	if disabled {
+		d.Logger.Warnw("webhook disabled after dead deliveries in a row",
+			"webhook", del.WebhookID, "community", del.Community, "dead", d.DisableAfter)
+	}
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
+
+func (d *Dispatcher) send(hook *Webhook, del *Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "redditclone-webhooks")
+	req.Header.Set(EventHeader, del.Event)
+	req.Header.Set(DeliveryHeader, del.ID)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, del.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,396 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/events"
+	post "redditclone/pkg/posts"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const testSecret = "test-secret"
+
+// receiver answers 500 to the first failures attempts of each delivery and
+// 200 afterwards, and records the deliveries whose signature was wrong.
+type receiver struct {
+	*httptest.Server
+	failures int
+	release  chan struct{}
+
+	mu        sync.Mutex
+	attempts  map[string]int
+	badSigned []string
+	received  []Payload
+}
+
+func newReceiver(t *testing.T, failures int) *receiver {
+	t.Helper()
+	rcv := &receiver{failures: failures, attempts: make(map[string]int)}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(rcv.serve))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *receiver) serve(w http.ResponseWriter, r *http.Request) {
+	if rcv.release != nil {
+		<-rcv.release
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	id := r.Header.Get(DeliveryHeader)
+	if r.Header.Get(SignatureHeader) != Sign(testSecret, body) {
+		rcv.badSigned = append(rcv.badSigned, id)
+	}
+	rcv.attempts[id]++
+	if rcv.attempts[id] <= rcv.failures {
+		http.Error(w, "try again", http.StatusInternalServerError)
+		return
+	}
+	payload := Payload{}
+	json.Unmarshal(body, &payload) //nolint:errcheck
+	rcv.received = append(rcv.received, payload)
+}
+
+func (rcv *receiver) checkSignatures(t *testing.T) {
+	t.Helper()
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	if len(rcv.badSigned) != 0 {
+		t.Errorf("deliveries with a wrong signature: %v", rcv.badSigned)
+	}
+}
+
+func newTestDispatcher(t *testing.T, repo Repo, rcv *receiver) (*Dispatcher, *events.Bus) {
+	t.Helper()
+	logger := zap.NewNop().Sugar()
+	d := NewDispatcher(repo, logger)
+	// the test receiver listens on loopback, which NewClient refuses
+	d.Client = rcv.Client()
+	d.BaseDelay, d.MaxDelay, d.PollInterval = 10*time.Millisecond, 40*time.Millisecond, 50*time.Millisecond
+
+	bus := events.NewBus(logger)
+	if err := d.Start(bus, 2); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		d.Stop()
+		bus.Close()
+	})
+	return d, bus
+}
+
+func addTestWebhook(t *testing.T, repo Repo, rcv *receiver, events ...string) *Webhook {
+	t.Helper()
+	if events == nil {
+		events = make([]string, 0)
+	}
+	hook := &Webhook{ID: "hook", Community: "hooks", URL: rcv.URL,
+		Events: events, Secret: testSecret, Created: now()}
+	if err := repo.AddWebhook(hook); err != nil {
+		t.Fatal(err)
+	}
+	return hook
+}
+
+func publishPost(bus *events.Bus, id string) {
+	bus.Publish(events.PostCreated{Post: post.Post{ID: id, Category: "hooks", Title: "title " + id}})
+}
+
+// waitForDeliveries waits until the webhook has n deliveries, none of them
+// pending, and returns them newest first.
+func waitForDeliveries(t *testing.T, repo Repo, hookID string, n int) []*Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := repo.GetDeliveries(hookID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		settled := len(deliveries) == n
+		for _, del := range deliveries {
+			if del.Status == StatusPending {
+				settled = false
+			}
+		}
+		if settled {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			for _, del := range deliveries {
+				t.Logf("%s %s attempts=%d error=%q", del.ID, del.Status, del.Attempts, del.Error)
+			}
+			t.Fatalf("got %d settled deliveries, want %d", len(deliveries), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcherRetriesUntilDelivered(t *testing.T) {
+	repo := NewMemoryRepository()
+	rcv := newReceiver(t, 2)
+	_, bus := newTestDispatcher(t, repo, rcv)
+	hook := addTestWebhook(t, repo, rcv)
+
+	publishPost(bus, "p1")
+	del := waitForDeliveries(t, repo, hook.ID, 1)[0]
+
+	if del.Status != StatusDelivered || del.Attempts != 3 || del.ResponseStatus != http.StatusOK || del.Error != "" {
+		t.Errorf("got %s after %d attempts, status %d, error %q; want delivered after 3 attempts",
+			del.Status, del.Attempts, del.ResponseStatus, del.Error)
+	}
+	if del.Event != EventPostCreated {
+		t.Errorf("event = %q, want %q", del.Event, EventPostCreated)
+	}
+	rcv.checkSignatures(t)
+	if len(rcv.received) != 1 || rcv.received[0].ID != del.ID || rcv.received[0].Community != "hooks" {
+		t.Errorf("received %+v, want the payload of delivery %s", rcv.received, del.ID)
+	}
+}
+
+func TestDispatcherDeadLetterAndRedeliver(t *testing.T) {
+	repo := NewMemoryRepository()
+	rcv := newReceiver(t, 3)
+	d, bus := newTestDispatcher(t, repo, rcv)
+	d.MaxAttempts = 3
+	hook := addTestWebhook(t, repo, rcv)
+
+	publishPost(bus, "p1")
+	del := waitForDeliveries(t, repo, hook.ID, 1)[0]
+	if del.Status != StatusDead || del.Attempts != 3 || del.ResponseStatus != http.StatusInternalServerError {
+		t.Fatalf("got %s after %d attempts, status %d; want dead after 3 attempts",
+			del.Status, del.Attempts, del.ResponseStatus)
+	}
+	dead, err := repo.GetDeliveries(hook.ID, StatusDead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != del.ID {
+		t.Errorf("dead letters = %v, want %s", dead, del.ID)
+	}
+
+	// the receiver answers 200 from the fourth attempt on
+	if err = d.Redeliver(del); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Redeliver(del); !errors.Is(err, ErrDeliveryPending) {
+		t.Errorf("Redeliver of a pending delivery: err = %v, want %v", err, ErrDeliveryPending)
+	}
+	del = waitForDeliveries(t, repo, hook.ID, 1)[0]
+	if del.Status != StatusDelivered || del.Attempts != 1 || del.Error != "" {
+		t.Errorf("redelivery: got %s after %d attempts, error %q; want delivered after 1 attempt",
+			del.Status, del.Attempts, del.Error)
+	}
+	rcv.checkSignatures(t)
+}
+
+func TestDispatcherDisablesWebhook(t *testing.T) {
+	repo := NewMemoryRepository()
+	rcv := newReceiver(t, 100)
+	d, bus := newTestDispatcher(t, repo, rcv)
+	d.MaxAttempts, d.DisableAfter = 1, 2
+	hook := addTestWebhook(t, repo, rcv)
+
+	publishPost(bus, "p1")
+	waitForDeliveries(t, repo, hook.ID, 1)
+	publishPost(bus, "p2")
+	deliveries := waitForDeliveries(t, repo, hook.ID, 2)
+
+	got, err := repo.GetWebhook(hook.Community, hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Disabled || got.DeadInARow != 2 {
+		t.Fatalf("after 2 dead deliveries: disabled = %v, dead in a row = %d; want disabled after 2",
+			got.Disabled, got.DeadInARow)
+	}
+	publishPost(bus, "p3")
+	waitForDeliveries(t, repo, hook.ID, 2)
+	if err = d.Redeliver(deliveries[0]); !errors.Is(err, ErrWebhookDisabled) {
+		t.Errorf("Redeliver to a disabled webhook: err = %v, want %v", err, ErrWebhookDisabled)
+	}
+
+	// a pending delivery dies unsent once its webhook is disabled
+	left := &Delivery{ID: "left-over", WebhookID: hook.ID, Community: hook.Community, Event: EventPostCreated,
+		Payload: json.RawMessage(`{}`), Status: StatusPending, Created: now()}
+	if err = repo.SaveDelivery(left); err != nil {
+		t.Fatal(err)
+	}
+	d.notify()
+	left = waitForDeliveries(t, repo, hook.ID, 3)[0]
+	if left.Status != StatusDead || left.Attempts != 0 || left.Error != ErrWebhookDisabled.Error() {
+		t.Errorf("pending delivery of a disabled webhook: %s after %d attempts, error %q",
+			left.Status, left.Attempts, left.Error)
+	}
+
+	if err = repo.EnableWebhook(hook.Community, hook.ID); err != nil {
+		t.Fatal(err)
+	}
+	rcv.mu.Lock()
+	rcv.failures = 0
+	rcv.mu.Unlock()
+	publishPost(bus, "p4")
+	if del := waitForDeliveries(t, repo, hook.ID, 4)[0]; del.Status != StatusDelivered {
+		t.Errorf("after enabling the webhook the delivery is %s, want delivered", del.Status)
+	}
+	if got, err = repo.GetWebhook(hook.Community, hook.ID); err != nil || got.Disabled || got.DeadInARow != 0 {
+		t.Errorf("enabled webhook: %+v, %v", got, err)
+	}
+}
+
+func TestRepositoryCapsDeadLetters(t *testing.T) {
+	repo := NewMemoryRepository()
+	for i := 0; i < DeadLetterLimit+5; i++ {
+		del := &Delivery{ID: "d" + strconv.Itoa(i), WebhookID: "hook", Community: "hooks", Event: EventPostCreated,
+			Status: StatusPending, Created: now()}
+		if err := repo.SaveDelivery(del); err != nil {
+			t.Fatal(err)
+		}
+		del.Status = StatusDead
+		if err := repo.SaveDelivery(del); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dead, err := repo.GetDeliveries("hook", StatusDead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != DeadLetterLimit {
+		t.Fatalf("%d dead letters kept, want %d", len(dead), DeadLetterLimit)
+	}
+	if newest, oldest := dead[0].ID, dead[len(dead)-1].ID; newest != "d104" || oldest != "d5" {
+		t.Errorf("kept dead letters %s to %s, want d5 to d104", oldest, newest)
+	}
+}
+
+func TestDispatcherHistory(t *testing.T) {
+	repo := NewMemoryRepository()
+	rcv := newReceiver(t, 0)
+	_, bus := newTestDispatcher(t, repo, rcv)
+	hook := addTestWebhook(t, repo, rcv, EventPostCreated)
+
+	publishPost(bus, "p1")
+	waitForDeliveries(t, repo, hook.ID, 1)
+	publishPost(bus, "p2")
+	bus.Publish(events.PostDeleted{PostID: "p1", Category: "hooks"})
+	bus.Publish(events.PostCreated{Post: post.Post{ID: "p3", Category: "elsewhere"}})
+	deliveries := waitForDeliveries(t, repo, hook.ID, 2)
+
+	if deliveries[0].Created < deliveries[1].Created {
+		t.Errorf("history is not newest first: %s before %s", deliveries[0].Created, deliveries[1].Created)
+	}
+	for _, del := range deliveries {
+		if del.Status != StatusDelivered || del.Event != EventPostCreated || del.Community != "hooks" {
+			t.Errorf("unexpected delivery %+v", del)
+		}
+	}
+	delivered, err := repo.GetDeliveries(hook.ID, StatusDelivered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 2 {
+		t.Errorf("%d delivered, want 2", len(delivered))
+	}
+	got, err := repo.GetDelivery(hook.ID, deliveries[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := Payload{}
+	if err = json.Unmarshal(got.Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID != got.ID || payload.Event != EventPostCreated {
+		t.Errorf("stored payload %+v does not match delivery %s", payload, got.ID)
+	}
+	rcv.checkSignatures(t)
+}
+
+func TestDispatcherResumesPending(t *testing.T) {
+	repo := NewMemoryRepository()
+	rcv := newReceiver(t, 0)
+	hook := addTestWebhook(t, repo, rcv)
+	del := &Delivery{ID: "left-over", WebhookID: hook.ID, Community: hook.Community, Event: EventPostCreated,
+		Payload: json.RawMessage(`{}`), Status: StatusPending, Attempts: 1, Created: now(), NextAttempt: now()}
+	if err := repo.SaveDelivery(del); err != nil {
+		t.Fatal(err)
+	}
+
+	newTestDispatcher(t, repo, rcv)
+	got := waitForDeliveries(t, repo, hook.ID, 1)[0]
+	if got.Status != StatusDelivered || got.Attempts != 2 {
+		t.Errorf("got %s after %d attempts, want delivered after 2", got.Status, got.Attempts)
+	}
+}
+
+// A receiver that does not answer must not hold up the writers: the
+// deliveries wait as pending rows until the workers get to them.
+func TestDispatcherSlowReceiver(t *testing.T) {
+	repo := NewMemoryRepository()
+	rcv := newReceiver(t, 0)
+	rcv.release = make(chan struct{})
+	_, bus := newTestDispatcher(t, repo, rcv)
+	hook := addTestWebhook(t, repo, rcv)
+
+	const n = 50
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		publishPost(bus, "p"+strconv.Itoa(i))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("publishing took %v while the receiver was stuck", elapsed)
+	}
+	pending, err := repo.GetDeliveries(hook.ID, StatusPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != n {
+		t.Errorf("%d pending deliveries, want %d", len(pending), n)
+	}
+
+	close(rcv.release)
+	for _, del := range waitForDeliveries(t, repo, hook.ID, n) {
+		if del.Status != StatusDelivered || del.Attempts != 1 {
+			t.Errorf("delivery %s: %s after %d attempts", del.ID, del.Status, del.Attempts)
+		}
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	rcv := newReceiver(t, 0)
+	resp, err := NewClient().Post(rcv.URL, "application/json", nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("request to %s: err = %v, want %v", rcv.URL, err, ErrForbiddenAddress)
+	}
+
+	redirect := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:1/", nil)
+	if err = checkRedirect(redirect, nil); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("redirect to loopback: err = %v, want %v", err, ErrForbiddenAddress)
+	}
+
+	for _, raw := range []string{"http://127.0.0.1/", "http://10.1.2.3/", "http://[::1]:8080/", "http://169.254.169.254/",
+		"http://0.0.0.0/", "ftp://example.com/"} {
+		if err = CheckURL(raw); !errors.Is(err, ErrBadURL) {
+			t.Errorf("CheckURL(%q) = %v, want %v", raw, err, ErrBadURL)
+		}
+	}
+	if err = CheckURL("https://example.com/hook"); err != nil {
+		t.Errorf("CheckURL of a public URL: %v", err)
+	}
+}
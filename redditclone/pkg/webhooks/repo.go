@@ -0,0 +1,197 @@
+package webhooks
+
+import (
+	"sync"
+)
+
+type MemoryRepository struct {
+	hooks      map[string][]*Webhook
+	deliveries map[string][]*Delivery
+	mu         sync.RWMutex
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{hooks: make(map[string][]*Webhook), deliveries: make(map[string][]*Delivery)}
+}
+
+// The stored webhooks change as their deliveries die, so the repository
+// keeps its own copies and hands out copies.
+func (repo *MemoryRepository) AddWebhook(w *Webhook) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored := *w
+	repo.hooks[w.Community] = append(repo.hooks[w.Community], &stored)
+	return nil
+}
+
+func (repo *MemoryRepository) GetWebhook(community, id string) (*Webhook, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	if w := repo.findWebhook(community, id); w != nil {
+		copied := *w
+		return &copied, nil
+	}
+	return nil, ErrWebhookNotFound
+}
+
+func (repo *MemoryRepository) findWebhook(community, id string) *Webhook {
+	for _, w := range repo.hooks[community] {
+		if w.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) GetWebhooks(community string) ([]*Webhook, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	hooks := make([]*Webhook, 0, len(repo.hooks[community]))
+	for _, w := range repo.hooks[community] {
+		copied := *w
+		hooks = append(hooks, &copied)
+	}
+	return hooks, nil
+}
+
+func (repo *MemoryRepository) DeleteWebhook(community, id string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	hooks := repo.hooks[community]
+	for i, w := range hooks {
+		if w.ID == id {
+			repo.hooks[community] = append(hooks[:i:i], hooks[i+1:]...)
+			delete(repo.deliveries, id)
+			return nil
+		}
+	}
+	return ErrWebhookNotFound
+}
+
+// SaveDelivery stores a copy, so the dispatcher may go on changing d.
+func (repo *MemoryRepository) SaveDelivery(d *Delivery) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored := *d
+	history := repo.deliveries[d.WebhookID]
+	found := false
+	for i, old := range history {
+		if old.ID == d.ID {
+			history[i] = &stored
+			found = true
+			break
+		}
+	}
+	if !found {
+		history = append(history, &stored)
+	}
+	repo.deliveries[d.WebhookID] = trimHistory(history)
+	return nil
+}
+
+// historyLimits is how many deliveries of each finished status are kept.
+var historyLimits = map[string]int{StatusDelivered: HistoryLimit, StatusDead: DeadLetterLimit}
+
+// trimHistory drops the oldest deliveries of the statuses over their limit.
+func trimHistory(history []*Delivery) []*Delivery {
+	counts := make(map[string]int)
+	for _, d := range history {
+		counts[d.Status]++
+	}
+	over := false
+	for status, limit := range historyLimits {
+		if counts[status] > limit {
+			over = true
+		}
+	}
+	if !over {
+		return history
+	}
+
+	kept := make([]*Delivery, 0, len(history))
+	for _, d := range history {
+		if limit, ok := historyLimits[d.Status]; ok && counts[d.Status] > limit {
+			counts[d.Status]--
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+func (repo *MemoryRepository) GetDelivery(webhookID, id string) (*Delivery, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	for _, d := range repo.deliveries[webhookID] {
+		if d.ID == id {
+			copied := *d
+			return &copied, nil
+		}
+	}
+	return nil, ErrDeliveryNotFound
+}
+
+func (repo *MemoryRepository) GetDeliveries(webhookID, status string) ([]*Delivery, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	history := repo.deliveries[webhookID]
+	deliveries := make([]*Delivery, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		if status == "" || history[i].Status == status {
+			copied := *history[i]
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	return deliveries, nil
+}
+
+func (repo *MemoryRepository) GetPendingDeliveries() ([]*Delivery, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	deliveries := make([]*Delivery, 0)
+	for _, history := range repo.deliveries {
+		for _, d := range history {
+			if d.Status == StatusPending {
+				copied := *d
+				deliveries = append(deliveries, &copied)
+			}
+		}
+	}
+	return deliveries, nil
+}
+
+func (repo *MemoryRepository) RecordResult(community, id string, dead bool, disableAfter int) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	w := repo.findWebhook(community, id)
+	if w == nil {
+		return false, ErrWebhookNotFound
+	}
+	if !dead {
+		w.DeadInARow = 0
+		return false, nil
+	}
+	w.DeadInARow++
+	if w.Disabled || disableAfter <= 0 || w.DeadInARow < disableAfter {
+		return false, nil
+	}
+	w.Disabled = true
+	return true, nil
+}
+
+func (repo *MemoryRepository) EnableWebhook(community, id string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	w := repo.findWebhook(community, id)
+	if w == nil {
+		return ErrWebhookNotFound
+	}
+	w.Disabled, w.DeadInARow = false, 0
+	return nil
+}
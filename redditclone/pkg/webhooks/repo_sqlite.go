@@ -0,0 +1,260 @@
+package webhooks
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS webhooks (
+		id         TEXT PRIMARY KEY,
+		community  TEXT NOT NULL,
+		url        TEXT NOT NULL,
+		events     TEXT NOT NULL DEFAULT '',
+		secret     TEXT NOT NULL,
+		owner_id   TEXT NOT NULL,
+		owner_name TEXT NOT NULL,
+		created    TEXT NOT NULL,
+		dead_in_a_row INTEGER NOT NULL DEFAULT 0,
+		disabled      INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS webhooks_community_idx ON webhooks (community)`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id              TEXT PRIMARY KEY,
+		webhook_id      TEXT NOT NULL,
+		community       TEXT NOT NULL,
+		event           TEXT NOT NULL,
+		payload         TEXT NOT NULL,
+		status          TEXT NOT NULL,
+		attempts        INTEGER NOT NULL DEFAULT 0,
+		response_status INTEGER NOT NULL DEFAULT 0,
+		error           TEXT NOT NULL DEFAULT '',
+		created         TEXT NOT NULL,
+		last_attempt    TEXT NOT NULL DEFAULT '',
+		next_attempt    TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_status_idx ON webhook_deliveries (status)`,
+}
+
+const webhookColumns = `id, community, url, events, secret, owner_id, owner_name, created, dead_in_a_row, disabled`
+
+const deliveryColumns = `id, webhook_id, community, event, payload, status, attempts, response_status, error,
+	created, last_attempt, next_attempt`
+
+func NewSQLiteRepository(db *sql.DB) (*SQLiteRepository, error) {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	// Webhooks stored before they could be disabled lack the columns.
+	for _, m := range []struct{ column, definition string }{
+		{"dead_in_a_row", "INTEGER NOT NULL DEFAULT 0"},
+		{"disabled", "INTEGER NOT NULL DEFAULT 0"},
+	} {
+		var ok bool
+		err := db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info('webhooks') WHERE name = ?`, m.column).Scan(&ok)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			continue
+		}
+		if _, err = db.Exec(`ALTER TABLE webhooks ADD COLUMN ` + m.column + ` ` + m.definition); err != nil {
+			return nil, err
+		}
+	}
+	return &SQLiteRepository{db: db}, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhook(row scanner) (*Webhook, error) {
+	w := &Webhook{}
+	var events string
+	err := row.Scan(&w.ID, &w.Community, &w.URL, &events, &w.Secret, &w.Owner.ID, &w.Owner.Username, &w.Created,
+		&w.DeadInARow, &w.Disabled)
+	if err != nil {
+		return nil, err
+	}
+	w.Events = make([]string, 0)
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+	return w, nil
+}
+
+func scanDelivery(row scanner) (*Delivery, error) {
+	d := &Delivery{}
+	var payload string
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Community, &d.Event, &payload, &d.Status, &d.Attempts,
+		&d.ResponseStatus, &d.Error, &d.Created, &d.LastAttempt, &d.NextAttempt)
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	return d, nil
+}
+
+func (repo *SQLiteRepository) AddWebhook(w *Webhook) error {
+	_, err := repo.db.Exec(`INSERT INTO webhooks (`+webhookColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.ID, w.Community, w.URL, strings.Join(w.Events, ","), w.Secret, w.Owner.ID, w.Owner.Username, w.Created,
+		w.DeadInARow, w.Disabled)
+	return err
+}
+
+func (repo *SQLiteRepository) GetWebhook(community, id string) (*Webhook, error) {
+	w, err := scanWebhook(repo.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE community = ? AND id = ?`,
+		community, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	return w, err
+}
+
+func (repo *SQLiteRepository) GetWebhooks(community string) ([]*Webhook, error) {
+	rows, err := repo.db.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE community = ? ORDER BY rowid`, community)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := make([]*Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, w)
+	}
+	return hooks, rows.Err()
+}
+
+func (repo *SQLiteRepository) DeleteWebhook(community, id string) error {
+	res, err := repo.db.Exec(`DELETE FROM webhooks WHERE community = ? AND id = ?`, community, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return err
+		}
+		return ErrWebhookNotFound
+	}
+	_, err = repo.db.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id)
+	return err
+}
+
+// SaveDelivery updates a stored delivery in place, keeping its position in
+// the history, and trims old successful and dead deliveries.
+func (repo *SQLiteRepository) SaveDelivery(d *Delivery) error {
+	_, err := repo.db.Exec(`INSERT INTO webhook_deliveries (`+deliveryColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET status = excluded.status, attempts = excluded.attempts,
+			response_status = excluded.response_status, error = excluded.error,
+			last_attempt = excluded.last_attempt, next_attempt = excluded.next_attempt`,
+		d.ID, d.WebhookID, d.Community, d.Event, string(d.Payload), d.Status, d.Attempts, d.ResponseStatus,
+		d.Error, d.Created, d.LastAttempt, d.NextAttempt)
+	if err != nil {
+		return err
+	}
+	for status, limit := range historyLimits {
+		_, err = repo.db.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ? AND status = ? AND rowid NOT IN (
+			SELECT rowid FROM webhook_deliveries WHERE webhook_id = ? AND status = ? ORDER BY rowid DESC LIMIT ?)`,
+			d.WebhookID, status, d.WebhookID, status, limit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repo *SQLiteRepository) GetDelivery(webhookID, id string) (*Delivery, error) {
+	d, err := scanDelivery(repo.db.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = ? AND id = ?`, webhookID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeliveryNotFound
+	}
+	return d, err
+}
+
+func (repo *SQLiteRepository) GetDeliveries(webhookID, status string) ([]*Delivery, error) {
+	return repo.queryDeliveries(`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = ? AND (? = '' OR status = ?) ORDER BY rowid DESC`, webhookID, status, status)
+}
+
+func (repo *SQLiteRepository) GetPendingDeliveries() ([]*Delivery, error) {
+	return repo.queryDeliveries(`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE status = ? ORDER BY rowid`, StatusPending)
+}
+
+func (repo *SQLiteRepository) queryDeliveries(query string, args ...any) ([]*Delivery, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*Delivery, 0)
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordResult counts and disables in one statement, so results recorded
+// by several workers at once are all counted. The count only grows until
+// the webhook is enabled again, so it reaches the limit once.
+func (repo *SQLiteRepository) RecordResult(community, id string, dead bool, disableAfter int) (bool, error) {
+	if !dead {
+		res, err := repo.db.Exec(`UPDATE webhooks SET dead_in_a_row = 0 WHERE community = ? AND id = ?`, community, id)
+		if err != nil {
+			return false, err
+		}
+		return false, webhookAffected(res)
+	}
+
+	var disabled bool
+	err := repo.db.QueryRow(`UPDATE webhooks SET dead_in_a_row = dead_in_a_row + 1,
+			disabled = disabled OR (? > 0 AND dead_in_a_row + 1 >= ?)
+		WHERE community = ? AND id = ?
+		RETURNING ? > 0 AND dead_in_a_row = ?`,
+		disableAfter, disableAfter, community, id, disableAfter, disableAfter).Scan(&disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrWebhookNotFound
+	}
+	return disabled, err
+}
+
+func (repo *SQLiteRepository) EnableWebhook(community, id string) error {
+	res, err := repo.db.Exec(`UPDATE webhooks SET disabled = 0, dead_in_a_row = 0 WHERE community = ? AND id = ?`,
+		community, id)
+	if err != nil {
+		return err
+	}
+	return webhookAffected(res)
+}
+
+func webhookAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"redditclone/pkg/community"
+	"redditclone/pkg/events"
+	post "redditclone/pkg/posts"
+	"time"
+)
+
+// Events a webhook can ask for.
+const (
+	EventPostCreated    = "post_created"
+	EventPostEdited     = "post_edited"
+	EventPostDeleted    = "post_deleted"
+	EventCommentAdded   = "comment_added"
+	EventCommentDeleted = "comment_deleted"
+	EventVoteCast       = "vote_cast"
+)
+
+var KnownEvents = []string{EventPostCreated, EventPostEdited, EventPostDeleted,
+	EventCommentAdded, EventCommentDeleted, EventVoteCast}
+
+// Statuses of a delivery. A dead delivery used up its attempts and stays in
+// the history as the dead letter until it is redelivered.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Headers of a delivery. The signature is the hex HMAC-SHA256 of the body
+// under the secret of the webhook, prefixed with "sha256=".
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	ErrDeliveryPending  = errors.New("delivery is still pending")
+	ErrWebhookDisabled  = errors.New("webhook is disabled")
+	ErrBadURL           = errors.New("webhook url must be an absolute http or https url of a public host")
+	ErrUnknownEvent     = errors.New("unknown webhook event")
+	ErrForbiddenAddress = errors.New("webhook address is not public")
+)
+
+// Webhook sends the events of a community to URL; an empty Events list
+// means all of them. The secret is only shown when the webhook is created.
+// DeadInARow counts the dead deliveries since the last successful one; when
+// there are too many the dispatcher disables the webhook, and no events are
+// sent to it until it is enabled again.
+type Webhook struct {
+	ID         string           `json:"id"`
+	Community  string           `json:"community"`
+	URL        string           `json:"url"`
+	Events     []string         `json:"events"`
+	Secret     string           `json:"-"`
+	Owner      community.Member `json:"owner"`
+	Created    string           `json:"created"`
+	DeadInARow int              `json:"deadInARow"`
+	Disabled   bool             `json:"disabled"`
+}
+
+// Delivery is one event sent to one webhook, with the outcome of its last
+// attempt. NextAttempt is set while a retry is scheduled.
+type Delivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhookId"`
+	Community      string          `json:"community"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"responseStatus,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	Created        string          `json:"created"`
+	LastAttempt    string          `json:"lastAttempt,omitempty"`
+	NextAttempt    string          `json:"nextAttempt,omitempty"`
+}
+
+// Repo keeps the webhooks and their delivery history. Deleting a webhook
+// deletes its deliveries.
+type Repo interface {
+	AddWebhook(w *Webhook) error
+	GetWebhook(community, id string) (*Webhook, error)
+	GetWebhooks(community string) ([]*Webhook, error)
+	DeleteWebhook(community, id string) error
+	// SaveDelivery adds the delivery or updates the stored one.
+	SaveDelivery(d *Delivery) error
+	GetDelivery(webhookID, id string) (*Delivery, error)
+	// GetDeliveries lists the deliveries of the webhook, newest first,
+	// limited to one status unless status is empty.
+	GetDeliveries(webhookID, status string) ([]*Delivery, error)
+	GetPendingDeliveries() ([]*Delivery, error)
+	// RecordResult counts a dead delivery of the webhook, or resets the
+	// count after a successful one, and disables the webhook once
+	// disableAfter deliveries in a row are dead; zero never disables it.
+	// It tells whether the webhook was disabled just now.
+	RecordResult(community, id string, dead bool, disableAfter int) (bool, error)
+	// EnableWebhook resumes the deliveries of a disabled webhook.
+	EnableWebhook(community, id string) error
+}
+
+// HistoryLimit is how many successful deliveries are kept per webhook and
+// DeadLetterLimit how many dead ones; the oldest go first. Pending ones are
+// always kept.
+const (
+	HistoryLimit    = 100
+	DeadLetterLimit = 100
+)
+
+func IsEvent(name string) bool {
+	for _, e := range KnownEvents {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL accepts absolute http and https URLs, except those naming an
+// internal address outright. Host names are checked when the dispatcher
+// connects, once they are resolved.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrBadURL
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !publicIP(ip) {
+		return ErrBadURL
+	}
+	return nil
+}
+
+// publicIP tells whether deliveries may go to an address: loopback,
+// private, link-local, multicast and unspecified addresses belong to the
+// server's own network.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+func (w *Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the value of the signature header for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func NewSecret() (string, error) {
+	return randomHex(32)
+}
+
+func newID() (string, error) {
+	return randomHex(12)
+}
+
+func randomHex(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// Payload is the body of a delivery. ID is the ID of the delivery, which
+// stays the same on retries so that receivers can drop duplicates.
+type Payload struct {
+	ID        string `json:"id"`
+	Event     string `json:"event"`
+	Community string `json:"community"`
+	Created   string `json:"created"`
+	Data      any    `json:"data"`
+}
+
+type postDeletedData struct {
+	PostID string      `json:"postId"`
+	Title  string      `json:"title"`
+	Author post.Author `json:"author"`
+}
+
+type commentData struct {
+	PostID  string        `json:"postId"`
+	Comment *post.Comment `json:"comment"`
+}
+
+type commentDeletedData struct {
+	PostID    string `json:"postId"`
+	CommentID string `json:"commentId"`
+}
+
+type voteData struct {
+	PostID           string `json:"postId"`
+	CommentID        string `json:"commentId,omitempty"`
+	Vote             int    `json:"vote"`
+	Score            int    `json:"score"`
+	UpvotePercentage int    `json:"upvotePercentage,omitempty"`
+}
+
+// communityEvent names the domain event for webhooks and returns its
+// community and data; ok is false for events webhooks do not carry.
+func communityEvent(e events.Event) (name, community string, data any, ok bool) {
+	switch e := e.(type) {
+	case events.PostCreated:
+		return EventPostCreated, e.Post.Category, e.Post, true
+	case events.PostEdited:
+		return EventPostEdited, e.Post.Category, e.Post, true
+	case events.PostDeleted:
+		return EventPostDeleted, e.Category, postDeletedData{PostID: e.PostID, Title: e.Title, Author: e.Author}, true
+	case events.CommentAdded:
+		return EventCommentAdded, e.Category, commentData{PostID: e.PostID, Comment: &e.Comment}, true
+	case events.CommentDeleted:
+		return EventCommentDeleted, e.Category, commentDeletedData{PostID: e.PostID, CommentID: e.CommentID}, true
+	case events.VoteCast:
+		return EventVoteCast, e.Category, voteData{PostID: e.PostID, CommentID: e.CommentID, Vote: e.Vote,
+			Score: e.Score, UpvotePercentage: e.UpvotePercentage}, true
+	}
+	return "", "", nil, false
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}